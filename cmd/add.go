@@ -34,20 +34,21 @@ var addCmd = &cobra.Command{
 	Short: "Load a new RSS feed to the store",
 	Long:  `add takes a single argument which is an RSS feed url.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if store.Subscribed(args[0]) {
+			fmt.Printf("Already subscribed to [%s].\n", args[0])
+			return
+		}
+
 		fmt.Println("Loading ", args[0])
 		feed, err := pod.FromRSS(args[0])
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		if !store.Exists(feed.Title) {
-			store.Feeds = append(store.Feeds, &feed)
-			if err := pod.WriteStore(store); err != nil {
-				log.Fatal(err)
-			}
-			return
+		if err := store.AddFeed(&feed); err != nil {
+			log.Fatal(err)
 		}
-		fmt.Printf("Existing feed with name [%s] found.\n", feed.Title)
+		fmt.Printf("Added [%s] as %s\n", feed.Title, feed.Slug)
 	},
 }
 
@@ -0,0 +1,146 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nboughton/yapa/player"
+	"github.com/nboughton/yapa/pod"
+)
+
+// loadChapters fetches the chapters of an episode if they aren't already in
+// the store. Chapters are a nicety, so failures are ignored and only retried
+// the next day.
+func loadChapters(f *pod.Feed, ep *pod.Episode) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store.LoadChapters(ctx, f, ep)
+}
+
+// fetchChapters fetches the chapters of ep in the background, if they're due,
+// without touching ep as it may be in use elsewhere. done is then called from
+// the background with a func that records the result on ep, the chapters or
+// that they couldn't be fetched, for the caller to run wherever it's safe to
+// change and save ep.
+func fetchChapters(ep *pod.Episode, done func(record func())) {
+	if !ep.ChaptersDue() {
+		return
+	}
+
+	loaded := pod.Episode{Mp3: ep.Mp3, File: ep.File, ChaptersURL: ep.ChaptersURL}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		loaded.LoadChapters(ctx)
+		done(func() {
+			ep.Chapters, ep.ChaptersLoaded, ep.ChaptersFailed = loaded.Chapters, loaded.ChaptersLoaded, loaded.ChaptersFailed
+		})
+	}()
+}
+
+// seekChapter skips delta chapters forwards or backwards from the one that's
+// playing. Going back from a few seconds into a chapter restarts it first.
+func seekChapter(p player.Player, chapters pod.Chapters, delta int) error {
+	if len(chapters) == 0 {
+		return fmt.Errorf("this episode has no chapters")
+	}
+
+	pos := p.Status().Position
+	i := chapters.At(pos)
+	if delta < 0 && i >= 0 && pos-chapters[i].Start > 3 {
+		delta++
+	}
+
+	i += delta
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(chapters) {
+		return nil
+	}
+
+	return p.Seek(chapters[i].Start)
+}
+
+// chapterStatus describes the chapter playing at pos
+func chapterStatus(chapters pod.Chapters, pos float64) string {
+	i := chapters.At(pos)
+	if i < 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d: %s", i, chapters[i].Title)
+}
+
+var (
+	keysOnce sync.Once
+	keys     = make(chan byte)
+)
+
+// readKeys returns keys pressed while playing. Stdin is read for as long as
+// yapa runs so that one episode's reader can't swallow the next one's keys.
+func readKeys() <-chan byte {
+	keysOnce.Do(func() {
+		go func() {
+			b := make([]byte, 1)
+			for {
+				if _, err := os.Stdin.Read(b); err != nil {
+					return
+				}
+				keys <- b[0]
+			}
+		}()
+	})
+
+	return keys
+}
+
+// cbreak makes keys available as soon as they're pressed, without echoing
+// them, and returns a function that puts the terminal back. Nothing changes if
+// stdin isn't a terminal.
+func cbreak() func() {
+	saved, err := stty("-g")
+	if err != nil {
+		return func() {}
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return func() {}
+	}
+
+	return func() { stty(strings.TrimSpace(saved)) }
+}
+
+// run stty against the terminal on stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
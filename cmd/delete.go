@@ -26,7 +26,6 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/nboughton/yapa/pod"
 	"github.com/spf13/cobra"
 )
 
@@ -37,16 +36,16 @@ var deleteCmd = &cobra.Command{
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
 		var (
-			feed, _     = cmd.Flags().GetInt("feed")
 			playlist, _ = cmd.Flags().GetString("playlist")
 		)
 
-		if feed < 0 {
-			fmt.Println("Please specify a feed.")
+		feed, err := feedFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
 			return
 		}
-		if err := validFeed(feed); err != nil {
-			fmt.Println(err)
+		if feed < 0 {
+			fmt.Println("Please specify a feed.")
 			return
 		}
 
@@ -59,26 +58,28 @@ var deleteCmd = &cobra.Command{
 				fmt.Printf("Delete playist '%s', ", playlist)
 				if confirm() {
 					delete(store.Feeds[feed].Playlists, playlist)
-					pod.WriteStore(store)
+					store.SaveFeed(store.Feeds[feed])
 					fmt.Printf("Playlist '%s' deleted.\n", playlist)
 				}
 				return
 			}
 		}
 
-		title := store.Feeds[feed].Title
+		title := store.Feeds[feed].DisplayTitle()
 		fmt.Printf("Delete feed '%s', ", title)
 		if confirm() {
-			store.Feeds = append(store.Feeds[:feed], store.Feeds[feed+1:]...)
+			if err := store.DeleteFeed(feed); err != nil {
+				fmt.Println(err)
+				return
+			}
 			fmt.Printf("Feed '%s' deleted.\n", title)
-			pod.WriteStore(store)
 		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(deleteCmd)
-	deleteCmd.Flags().IntP("feed", "f", -1, "Feed to delete or delete playlist to delete from")
+	deleteCmd.Flags().StringP("feed", "f", "", "Feed to delete or delete playlist to delete from")
 	deleteCmd.Flags().StringP("playlist", "l", "", "Playlist to delete")
 }
 
@@ -0,0 +1,189 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nboughton/yapa/pod"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// downloadCmd represents the download command
+var downloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "Download episodes for offline listening",
+	Long: `Episodes are saved to the directory set by the library config key (~/Podcasts by
+default). By default every unplayed episode of the feed that hasn't already
+been downloaded is fetched. Interrupted downloads are resumed where they left off
+and play uses the local copy of an episode when there is one.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			episodes, _ = cmd.Flags().GetString("episodes")
+			playlist, _ = cmd.Flags().GetString("playlist")
+			limit, _    = cmd.Flags().GetInt("limit")
+			noVerify, _ = cmd.Flags().GetBool("no-verify")
+		)
+
+		feed, err := feedFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if feed < 0 {
+			fmt.Println("Please specify a feed.")
+			return
+		}
+
+		f := store.Feeds[feed]
+
+		var eps pod.Episodes
+		switch {
+		case episodes != "":
+			eps = f.Set(episodes)
+		case playlist != "":
+			eps = f.Playlist(playlist)
+		default:
+			for _, ep := range f.Ordered() {
+				if !ep.Played {
+					eps = append(eps, ep)
+				}
+			}
+		}
+
+		var downloads []*pod.Download
+		for _, ep := range eps {
+			if limit > 0 && len(downloads) == limit {
+				break
+			}
+			if ep.Downloaded() {
+				continue
+			}
+
+			d := pod.NewDownload(viper.GetString("library"), f, ep)
+			d.Verify = !noVerify
+			downloads = append(downloads, d)
+		}
+
+		if len(downloads) == 0 {
+			fmt.Println("Nothing to download.")
+			return
+		}
+
+		// Redraw progress until the downloads finish
+		done := make(chan bool)
+		go func() {
+			tick := time.NewTicker(time.Second / 2)
+			defer tick.Stop()
+
+			for {
+				select {
+				case <-tick.C:
+					showDownloads(downloads)
+				case <-done:
+					showDownloads(downloads)
+					return
+				}
+			}
+		}()
+
+		pod.DownloadAll(context.Background(), downloads, viper.GetInt("download_workers"))
+		done <- true
+
+		if err := store.SaveFeed(f); err != nil {
+			log.Fatal(err)
+		}
+
+		var failed []*pod.Download
+		for _, d := range downloads {
+			if d.Err != nil {
+				failed = append(failed, d)
+			}
+		}
+
+		fmt.Printf("\nDownloaded %d/%d episodes\n", len(downloads)-len(failed), len(downloads))
+		if len(failed) > 0 {
+			fmt.Println("\nFailures:")
+			for _, d := range failed {
+				fmt.Fprintf(tw, "%s\t%s\n", d.Episode.Title, d.Err)
+			}
+			tw.Flush()
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(downloadCmd)
+
+	downloadCmd.Flags().StringP("feed", "f", "", "Feed to download episodes from")
+	downloadCmd.Flags().StringP("episodes", "e", "", "Download selected episodes as a range (0-10) or a comma separated set (3,5,6). No spaces")
+	downloadCmd.Flags().StringP("playlist", "l", "", "Download a saved playlist")
+	downloadCmd.Flags().IntP("limit", "n", 0, "Only download this many episodes")
+	downloadCmd.Flags().IntP("workers", "w", pod.DefaultDownloadWorkers, "Number of episodes to download at once")
+	downloadCmd.Flags().Bool("no-verify", false, "Don't check downloads against the size given in the feed")
+
+	viper.BindPFlag("download_workers", downloadCmd.Flags().Lookup("workers"))
+}
+
+// showDownloads redraws the progress of a set of downloads
+func showDownloads(downloads []*pod.Download) {
+	var finished, failed int
+
+	clear()
+	fmt.Fprint(tw, "Episode\tProgress\n")
+	for _, d := range downloads {
+		switch d.State() {
+		case pod.Downloading:
+			n, total := d.Progress()
+			if total > 0 {
+				fmt.Fprintf(tw, "%s\t%s/%s (%d%%)\n", d.Episode.Title, byteSize(n), byteSize(total), n*100/total)
+			} else {
+				fmt.Fprintf(tw, "%s\t%s\n", d.Episode.Title, byteSize(n))
+			}
+		case pod.Finished:
+			finished++
+		case pod.Failed:
+			failed++
+		}
+	}
+	fmt.Fprintf(tw, "\nFinished:\t%d/%d\nFailed:\t%d\n", finished, len(downloads), failed)
+	tw.Flush()
+}
+
+// byteSize formats a number of bytes for display
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,253 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nboughton/yapa/pod"
+	"github.com/spf13/cobra"
+)
+
+// feedCmd represents the feed command
+var feedCmd = &cobra.Command{
+	Use:   "feed",
+	Short: "Change settings for a feed",
+}
+
+// feedPolicyCmd represents the feed policy command
+var feedPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Set automatic download and clean up rules for a feed",
+	Long: `Policies are applied after every yapa update. --keep downloads the next N
+unplayed episodes so they're ready to play offline, --expire deletes downloaded
+episodes N days after they've been played. Set either to 0 to turn it off. With
+no flags the current policy is printed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		feed, err := feedFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if feed < 0 {
+			fmt.Println("Please specify a feed.")
+			return
+		}
+
+		f := store.Feeds[feed]
+		if cmd.Flags().Changed("keep") {
+			f.Policy.Keep, _ = cmd.Flags().GetInt("keep")
+		}
+		if cmd.Flags().Changed("expire") {
+			f.Policy.Expire, _ = cmd.Flags().GetInt("expire")
+		}
+
+		if cmd.Flags().Changed("keep") || cmd.Flags().Changed("expire") {
+			if err := store.SaveFeed(f); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		fmt.Printf("%s: %s\n", f.DisplayTitle(), f.Policy)
+	},
+}
+
+// feedOrderCmd represents the feed order command
+var feedOrderCmd = &cobra.Command{
+	Use:   "order [auto|oldest|newest|number]",
+	Short: "Set the order a feed's episodes are listed and played in",
+	Long: `auto, the default, plays serial feeds in season and episode number order and
+everything else oldest first, following the itunes:type the feed publishes.
+oldest and newest order by publish date and number by season and episode number
+whatever the feed says. With no argument the current order is printed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		feed, err := feedFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if feed < 0 {
+			fmt.Println("Please specify a feed.")
+			return
+		}
+
+		f := store.Feeds[feed]
+		if len(args) == 1 {
+			if err := pod.ValidOrder(args[0]); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			f.Order = args[0]
+			if f.Order == "auto" {
+				f.Order = ""
+			}
+			if err := store.SaveFeed(f); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		order := f.EffectiveOrder()
+		if f.Order == "" {
+			order = fmt.Sprintf("auto (%s)", order)
+		}
+		fmt.Printf("%s: %s\n", f.DisplayTitle(), order)
+	},
+}
+
+// feedSkipCmd represents the feed skip command
+var feedSkipCmd = &cobra.Command{
+	Use:   "skip",
+	Short: "Set which episodes of a feed are skipped when it's played",
+	Long: `Skip rules leave trailers, bonus episodes and anything with a matching title
+out when a feed or playlist is played, and out of download policies. With
+--mark they're also marked played, now and as they're published. Episodes picked
+with play -e, and anything played with play --include-bonus, ignore the rules.
+With no flags the current rules are printed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		reset, _ := cmd.Flags().GetBool("clear")
+
+		feed, err := feedFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if feed < 0 {
+			fmt.Println("Please specify a feed.")
+			return
+		}
+
+		f := store.Feeds[feed]
+		rules := f.Skip
+		if reset {
+			rules = pod.Skip{}
+		}
+		if cmd.Flags().Changed("types") {
+			rules.Types, _ = cmd.Flags().GetStringSlice("types")
+		}
+		if cmd.Flags().Changed("title") {
+			rules.Title, _ = cmd.Flags().GetString("title")
+		}
+		if cmd.Flags().Changed("mark") {
+			rules.Mark, _ = cmd.Flags().GetBool("mark")
+		}
+
+		if err := rules.Validate(); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if reset || cmd.Flags().Changed("types") || cmd.Flags().Changed("title") || cmd.Flags().Changed("mark") {
+			f.Skip = rules
+			if n := f.MarkSkipped(); n > 0 {
+				fmt.Printf("%d episodes marked played\n", n)
+			}
+			if err := store.SaveFeed(f); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		fmt.Printf("%s: %s\n", f.DisplayTitle(), f.Skip)
+	},
+}
+
+// feedEditCmd represents the feed edit command
+var feedEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Rename a feed and keep notes and tags with it",
+	Long: `edit sets a local name for a feed, used in place of the publisher's title
+everywhere yapa shows it, along with notes and tags. None of them are touched by
+updates. Set --name to "" to go back to the publisher's title. The publisher's
+title is only read when a feed is added, --refresh-title fetches it again.
+With no flags the feed's details are printed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		refresh, _ := cmd.Flags().GetBool("refresh-title")
+
+		feed, err := feedFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if feed < 0 {
+			fmt.Println("Please specify a feed.")
+			return
+		}
+
+		f := store.Feeds[feed]
+		if cmd.Flags().Changed("name") {
+			f.Name, _ = cmd.Flags().GetString("name")
+		}
+		if cmd.Flags().Changed("notes") {
+			f.Notes, _ = cmd.Flags().GetString("notes")
+		}
+		if cmd.Flags().Changed("tags") {
+			f.Tags, _ = cmd.Flags().GetStringSlice("tags")
+		}
+		if refresh {
+			latest, err := pod.FromRSS(f.RSS)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if latest.Title != f.Title {
+				fmt.Printf("Publisher's title changed from [%s] to [%s]\n", f.Title, latest.Title)
+				f.Title = latest.Title
+			}
+		}
+
+		if refresh || cmd.Flags().Changed("name") || cmd.Flags().Changed("notes") || cmd.Flags().Changed("tags") {
+			if err := store.SaveFeed(f); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		fmt.Fprint(tw, f.String())
+		tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(feedCmd)
+	feedCmd.AddCommand(feedPolicyCmd)
+	feedCmd.AddCommand(feedOrderCmd)
+	feedCmd.AddCommand(feedSkipCmd)
+	feedCmd.AddCommand(feedEditCmd)
+
+	feedPolicyCmd.Flags().StringP("feed", "f", "", "Feed to set the policy for")
+	feedPolicyCmd.Flags().IntP("keep", "k", 0, "Keep the next N unplayed episodes downloaded")
+	feedPolicyCmd.Flags().IntP("expire", "x", 0, "Delete downloaded episodes N days after they're played")
+
+	feedOrderCmd.Flags().StringP("feed", "f", "", "Feed to set the order of")
+
+	feedSkipCmd.Flags().StringP("feed", "f", "", "Feed to set skip rules for")
+	feedSkipCmd.Flags().StringSliceP("types", "t", nil, "Skip these episode types, trailer and/or bonus (trailer,bonus)")
+	feedSkipCmd.Flags().StringP("title", "r", "", "Skip episodes with titles matching a RE2 compatible regular expression")
+	feedSkipCmd.Flags().BoolP("mark", "m", false, "Mark skipped episodes played")
+	feedSkipCmd.Flags().Bool("clear", false, "Remove every skip rule")
+
+	feedEditCmd.Flags().StringP("feed", "f", "", "Feed to edit")
+	feedEditCmd.Flags().StringP("name", "n", "", "Show the feed under this name instead of the publisher's title")
+	feedEditCmd.Flags().String("notes", "", "Notes to keep with the feed")
+	feedEditCmd.Flags().StringSliceP("tags", "t", nil, "Tags for the feed, replacing any it has (news,comedy)")
+	feedEditCmd.Flags().Bool("refresh-title", false, "Fetch the publisher's current title")
+}
@@ -0,0 +1,97 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nboughton/yapa/pod"
+	"github.com/spf13/cobra"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import subscriptions from another app",
+}
+
+// importOPMLCmd represents the import opml command
+var importOPMLCmd = &cobra.Command{
+	Use:   "opml <file>",
+	Short: "Import feeds from an OPML file",
+	Long: `Every feed in the file is loaded and added to the store. Feeds that are already in the store are skipped.
+Feeds nested in category outlines are tagged with the categories.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		subs, err := pod.ReadOPML(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var (
+			added, skipped int
+			failed         = make(map[string]error)
+		)
+
+		for _, sub := range subs {
+			if store.Subscribed(sub.RSS) {
+				skipped++
+				continue
+			}
+
+			fmt.Println("Loading ", sub.RSS)
+			feed, err := pod.FromRSS(sub.RSS)
+			if err != nil {
+				failed[sub.Title] = err
+				continue
+			}
+
+			// Categories the feed was filed under become its tags
+			feed.Tags = sub.Categories
+			if err := store.AddFeed(&feed); err != nil {
+				log.Fatal(err)
+			}
+			added++
+		}
+
+		fmt.Printf("\nAdded %d feeds, skipped %d already in the store\n", added, skipped)
+		if len(failed) > 0 {
+			fmt.Println("\nFailures:")
+			for title, err := range failed {
+				fmt.Fprintf(tw, "%s\t%s\n", title, err)
+			}
+			tw.Flush()
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importOPMLCmd)
+}
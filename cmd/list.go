@@ -22,6 +22,8 @@ package cmd
 
 import (
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/nboughton/yapa/pod"
 	"github.com/spf13/cobra"
@@ -34,7 +36,6 @@ var listCmd = &cobra.Command{
 	Long:  `List output can be marked as played/unplayed, and saved as playlists.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var (
-			feed, _         = cmd.Flags().GetInt("feed")
 			episodes, _     = cmd.Flags().GetString("episodes")
 			filter, _       = cmd.Flags().GetString("filter")
 			save, _         = cmd.Flags().GetString("save")
@@ -44,9 +45,21 @@ var listCmd = &cobra.Command{
 			details, _      = cmd.Flags().GetBool("details")
 			markPlayed, _   = cmd.Flags().GetBool("mark-played")
 			markUnplayed, _ = cmd.Flags().GetBool("mark-unplayed")
+			output, _       = cmd.Flags().GetString("output")
+			format, _       = cmd.Flags().GetString("format")
+			sortBy, _       = cmd.Flags().GetString("sort")
+			reverse, _      = cmd.Flags().GetBool("reverse")
+			tag, _          = cmd.Flags().GetString("tag")
+			machine         = output != "" || format != ""
+			records         []record
 			playlist        []int
 		)
 
+		if err := validOutput(output, format); err != nil {
+			fmt.Println(err)
+			return
+		}
+
 		// Various checks to reject conflicting flags
 		if markPlayed && markUnplayed {
 			fmt.Println("Please only select mark-played OR mark-unplayed")
@@ -74,22 +87,44 @@ var listCmd = &cobra.Command{
 			return
 		}
 
-		if err := validFeed(feed); err != nil {
+		feed, err := feedFlag(cmd)
+		if err != nil {
 			fmt.Println(err)
 			return
 		}
 
+		// Smart playlists can span every feed
+		if q, ok := store.Smart[list]; ok && feed < 0 {
+			listSmart(q, details, markPlayed, markUnplayed, output, format, sortBy, reverse)
+			return
+		}
+
 		// No feed specified, print basic summary of all feeds
 		if feed < 0 {
+			if machine {
+				for i, f := range store.Feeds {
+					if tag == "" || f.Tagged(tag) {
+						records = append(records, newFeedRecord(i, f))
+					}
+				}
+				if err := writeRecords(output, format, records); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+
 			if !details {
-				fmt.Fprint(tw, "ID\tName\tEps\tPlayed\tLast Updated\n")
+				fmt.Fprint(tw, "ID\tSlug\tName\tEps\tPlayed\tLast Updated\n")
 			}
 
 			for i, feed := range store.Feeds {
+				if tag != "" && !feed.Tagged(tag) {
+					continue
+				}
 				if details {
 					fmt.Fprint(tw, feed.String())
 				} else {
-					fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%s\n", i, feed.Title, len(feed.Episodes), feed.Played(), feed.Updated.Format(dateFmt))
+					fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%s\n", i, feed.Slug, feed.DisplayTitle(), len(feed.Episodes), feed.Played(), feed.Updated.Format(dateFmt))
 				}
 			}
 
@@ -98,6 +133,12 @@ var listCmd = &cobra.Command{
 		}
 
 		// Print summary of selected feed
+		if summary && machine {
+			if err := writeRecords(output, format, []record{newFeedRecord(feed, store.Feeds[feed])}); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
 		if summary {
 			fmt.Fprint(tw, store.Feeds[feed].String())
 			tw.Flush()
@@ -105,7 +146,7 @@ var listCmd = &cobra.Command{
 		}
 
 		// List episodes from selected feed, apply mark/print full details if flagged
-		if !details {
+		if !details && !machine {
 			fmt.Fprint(tw, "ID\tName\tPlayed\tPub Date\n")
 		}
 
@@ -117,23 +158,52 @@ var listCmd = &cobra.Command{
 		case episodes != "":
 			eps = store.Feeds[feed].Set(episodes)
 		case list != "":
-			eps = store.Feeds[feed].Playlist(list)
+			if q, ok := store.Smart[list]; ok && store.Feeds[feed].Playlists[list] == nil {
+				if eps, err = q.Episodes(store.Feeds[feed]); err != nil {
+					fmt.Println(err)
+					return
+				}
+			} else {
+				eps = store.Feeds[feed].Playlist(list)
+			}
 		default:
-			eps = store.Feeds[feed].Episodes
+			eps = store.Feeds[feed].Ordered()
+		}
+
+		// Episodes are listed in the feed's order unless a sort is given
+		if cmd.Flags().Changed("sort") {
+			var err error
+			if eps, err = eps.SortBy(sortBy, reverse); err != nil {
+				fmt.Println(err)
+				return
+			}
+		} else if reverse {
+			eps = append(pod.Episodes{}, eps...)
+			for i, j := 0, len(eps)-1; i < j; i, j = i+1, j-1 {
+				eps[i], eps[j] = eps[j], eps[i]
+			}
 		}
 
 		// Iterate and process episodes
 		for _, ep := range eps {
 			if markPlayed {
-				ep.Played = true
+				ep.MarkPlayed(true)
 			}
 			if markUnplayed {
-				ep.Played = false
+				ep.MarkPlayed(false)
 			}
-			if details {
+			switch {
+			case machine:
+				records = append(records, episodeRecord{Feed: store.Feeds[feed].DisplayTitle(), Episode: ep})
+			case details:
+				// Chapters are only fetched for episodes picked out by id, listing a
+				// whole feed would mean a request for every episode
+				if episodes != "" {
+					loadChapters(store.Feeds[feed], ep)
+				}
 				fmt.Fprintln(tw, ep)
-			} else {
-				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", ep.ID, ep.Title, played(ep.Played), ep.Published.Format(dateFmt))
+			default:
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", ep.ID, episodeTitle(ep), played(ep.Played), ep.Published.Format(dateFmt))
 			}
 			if save != "" || add != "" {
 				playlist = append(playlist, ep.ID)
@@ -142,10 +212,15 @@ var listCmd = &cobra.Command{
 
 		// Write changes to store
 		if markPlayed || markUnplayed {
-			pod.WriteStore(store)
+			store.SaveFeed(store.Feeds[feed])
 		}
 
 		// Print list text
+		if machine {
+			if err := writeRecords(output, format, records); err != nil {
+				log.Fatal(err)
+			}
+		}
 		tw.Flush()
 
 		// Save the playlist
@@ -155,7 +230,7 @@ var listCmd = &cobra.Command{
 				store.Feeds[feed].Playlists = make(map[string][]int)
 			}
 			store.Feeds[feed].Playlists[save] = playlist
-			pod.WriteStore(store)
+			store.SaveFeed(store.Feeds[feed])
 
 			fmt.Printf("Playlist saved as '%s'\n", save)
 		}
@@ -164,7 +239,7 @@ var listCmd = &cobra.Command{
 		if add != "" {
 			if _, ok := store.Feeds[feed].Playlists[add]; ok {
 				store.Feeds[feed].Playlists[add] = append(store.Feeds[feed].Playlists[add], playlist...)
-				pod.WriteStore(store)
+				store.SaveFeed(store.Feeds[feed])
 
 				fmt.Printf("Episodes appended to '%s' playlist\n", add)
 			}
@@ -175,16 +250,78 @@ var listCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(listCmd)
 
-	listCmd.Flags().IntP("feed", "f", -1, "List episodes for feed")
+	listCmd.Flags().StringP("feed", "f", "", "List episodes for feed")
 	listCmd.Flags().StringP("filter", "r", ".*", "Filter episodes with a RE2 compatible regular expression")
 	listCmd.Flags().StringP("episodes", "e", "", "Filter episodes as a range (0-10) or a comma separated set (3,5,6). No spaces")
-	listCmd.Flags().StringP("playlist", "l", "", "Print playlist")
+	listCmd.Flags().StringP("playlist", "l", "", "Print playlist, or a smart playlist across every feed if no feed is selected")
 	listCmd.Flags().StringP("save", "s", "", "Save results as playlist")
 	listCmd.Flags().StringP("add-to-playlist", "a", "", "Append episodes to an existing playlist")
 	listCmd.Flags().BoolP("summary", "m", false, "Only print summary for selected feed")
 	listCmd.Flags().BoolP("details", "d", false, "Print full details of selected feed/episode")
+	listCmd.Flags().String("tag", "", "Only list feeds with this tag")
 	listCmd.Flags().BoolP("mark-played", "p", false, "Mark the listed episodes as played")
 	listCmd.Flags().BoolP("mark-unplayed", "u", false, "Mark the listed episodes as unplayed")
+	listCmd.Flags().StringP("output", "o", "", "Print machine readable output: json, csv or tsv")
+	listCmd.Flags().String("format", "", "Print each feed/episode with a Go text/template, e.g. '{{.Title}}'")
+	listCmd.Flags().String("sort", "published", "Sort episodes by "+strings.Join(pod.SortFields, ", ")+", instead of the feed's order")
+	listCmd.Flags().Bool("reverse", false, "Reverse the sort order")
+}
+
+// listSmart prints the episodes matching a smart playlist from every feed,
+// marking them played/unplayed if flagged
+func listSmart(q *pod.Query, details, markPlayed, markUnplayed bool, output, format, sortBy string, reverse bool) {
+	var (
+		machine = output != "" || format != ""
+		records []record
+	)
+
+	matches, err := q.Run(store.Feeds)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := pod.SortMatches(matches, sortBy, reverse); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if !details && !machine {
+		fmt.Fprint(tw, "Feed\tID\tName\tPlayed\tPub Date\n")
+	}
+
+	changed := make(map[*pod.Feed]bool)
+	for _, m := range matches {
+		if markPlayed {
+			m.Episode.MarkPlayed(true)
+		}
+		if markUnplayed {
+			m.Episode.MarkPlayed(false)
+		}
+		changed[m.Feed] = true
+
+		switch {
+		case machine:
+			records = append(records, episodeRecord{Feed: m.Feed.DisplayTitle(), Episode: m.Episode})
+		case details:
+			fmt.Fprintf(tw, "Feed:\t%s\n%s\n", m.Feed.DisplayTitle(), m.Episode)
+		default:
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", m.Feed.DisplayTitle(), m.Episode.ID, episodeTitle(m.Episode), played(m.Episode.Played), m.Episode.Published.Format(dateFmt))
+		}
+	}
+
+	if markPlayed || markUnplayed {
+		for f := range changed {
+			store.SaveFeed(f)
+		}
+	}
+
+	if machine {
+		if err := writeRecords(output, format, records); err != nil {
+			log.Fatal(err)
+		}
+	}
+	tw.Flush()
 }
 
 func played(p bool) string {
@@ -194,3 +331,12 @@ func played(p bool) string {
 
 	return "No"
 }
+
+// Flag episodes that have been pulled from their feed
+func episodeTitle(ep *pod.Episode) string {
+	if ep.Removed {
+		return ep.Title + " [removed from feed]"
+	}
+
+	return ep.Title
+}
@@ -0,0 +1,173 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nboughton/yapa/pod"
+)
+
+// record is a row of machine readable output
+type record interface {
+	header() []string
+	row() []string
+}
+
+// feedRecord is a feed as it's written by list --output
+type feedRecord struct {
+	ID         int        `json:"id"`
+	Slug       string     `json:"slug"`
+	Title      string     `json:"title"`
+	Publisher  string     `json:"publisher_title"`
+	URL        string     `json:"url"`
+	RSS        string     `json:"rss"`
+	Updated    time.Time  `json:"updated"`
+	Author     string     `json:"author,omitempty"`
+	Type       string     `json:"type,omitempty"`
+	Categories []string   `json:"categories,omitempty"`
+	Episodes   int        `json:"episodes"`
+	Played     int        `json:"played"`
+	Playlists  []string   `json:"playlists"`
+	Policy     pod.Policy `json:"policy"`
+	Tags       []string   `json:"tags,omitempty"`
+	Notes      string     `json:"notes,omitempty"`
+}
+
+func newFeedRecord(id int, f *pod.Feed) feedRecord {
+	r := feedRecord{
+		ID:         id,
+		Slug:       f.Slug,
+		Title:      f.DisplayTitle(),
+		Publisher:  f.Title,
+		URL:        f.URL,
+		RSS:        f.RSS,
+		Updated:    f.Updated,
+		Author:     f.Author,
+		Type:       f.Type,
+		Categories: f.Categories,
+		Episodes:   len(f.Episodes),
+		Played:     f.Played(),
+		Playlists:  []string{},
+		Policy:     f.Policy,
+		Tags:       f.Tags,
+		Notes:      f.Notes,
+	}
+	for name := range f.Playlists {
+		r.Playlists = append(r.Playlists, name)
+	}
+	sort.Strings(r.Playlists)
+
+	return r
+}
+
+func (r feedRecord) header() []string {
+	return []string{"id", "slug", "title", "url", "rss", "updated", "author", "type", "episodes", "played", "tags"}
+}
+
+func (r feedRecord) row() []string {
+	return []string{strconv.Itoa(r.ID), r.Slug, r.Title, r.URL, r.RSS, r.Updated.Format(time.RFC3339), r.Author, r.Type, strconv.Itoa(r.Episodes), strconv.Itoa(r.Played), strings.Join(r.Tags, ",")}
+}
+
+// episodeRecord is an episode as it's written by list --output, along with the
+// title of its feed
+type episodeRecord struct {
+	Feed string `json:"feed"`
+	*pod.Episode
+}
+
+func (r episodeRecord) header() []string {
+	return []string{"feed", "id", "title", "published", "duration", "season", "episode", "type", "played", "elapsed", "mp3", "file"}
+}
+
+func (r episodeRecord) row() []string {
+	return []string{r.Feed, strconv.Itoa(r.ID), r.Title, r.Published.Format(time.RFC3339), strconv.Itoa(r.Duration),
+		strconv.Itoa(r.Season), strconv.Itoa(r.Number), r.EpisodeType(), strconv.FormatBool(r.Played), strconv.Itoa(r.Elapsed), r.Mp3, r.File}
+}
+
+// validOutput checks the --output and --format flags
+func validOutput(output, format string) error {
+	switch {
+	case output != "" && format != "":
+		return fmt.Errorf("--output (-o) and --format are mutually exclusive")
+	case output != "" && output != "json" && output != "csv" && output != "tsv":
+		return fmt.Errorf("invalid output: [%s], use json, csv or tsv", output)
+	case format != "":
+		if _, err := template.New("format").Parse(format); err != nil {
+			return fmt.Errorf("invalid format: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// writeRecords writes records to stdout as a JSON array, CSV or TSV with a
+// header row, or with format executed for each record followed by a newline
+func writeRecords(output, format string, records []record) error {
+	if format != "" {
+		tmpl, err := template.New("format").Parse(format)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range records {
+			if err := tmpl.Execute(os.Stdout, r); err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+
+	if output == "json" {
+		if records == nil {
+			// Scripts expect an array even when nothing matched
+			records = []record{}
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	if output == "tsv" {
+		w.Comma = '\t'
+	}
+
+	if len(records) > 0 {
+		w.Write(records[0].header())
+	}
+	for _, r := range records {
+		w.Write(r.row())
+	}
+	w.Flush()
+
+	return w.Error()
+}
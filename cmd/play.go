@@ -24,13 +24,16 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/nboughton/yapa/mpris"
+	"github.com/nboughton/yapa/player"
 	"github.com/nboughton/yapa/pod"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // playCmd represents the play command
@@ -40,58 +43,160 @@ var playCmd = &cobra.Command{
 	//Long: ``,
 	Run: func(cmd *cobra.Command, args []string) {
 		var (
-			feed, _     = cmd.Flags().GetInt("feed")
 			speed, _    = cmd.Flags().GetFloat32("speed")
-			feedTitle   = store.Feeds[feed].Title
 			playlist, _ = cmd.Flags().GetString("playlist")
 			episodes, _ = cmd.Flags().GetString("episodes")
+			queue, _    = cmd.Flags().GetBool("queue")
+			bonus, _    = cmd.Flags().GetBool("include-bonus")
 		)
 
-		if err := validFeed(feed); err != nil {
+		if cmd.Flags().Changed("chapter") {
+			startChapter, _ = cmd.Flags().GetInt("chapter")
+		}
+
+		if queue {
+			playQueue(speed)
+			return
+		}
+
+		feed, err := feedFlag(cmd)
+		if err != nil {
 			fmt.Println(err)
 			return
 		}
+		if feed < 0 {
+			if feed = store.Feeds.Latest(); feed < 0 {
+				fmt.Println("No feeds to play, add one first.")
+				return
+			}
+		}
+
+		f := store.Feeds[feed]
 
-		if playlist != "" {
-			list, ok := store.Feeds[feed].Playlists[playlist]
-			if ok {
-				for _, id := range list {
-					play(store.Feeds[feed].Episodes[id], feedTitle, speed, true)
+		var list []pod.Match
+		switch {
+		case playlist != "":
+			if ids, ok := f.Playlists[playlist]; ok {
+				for _, id := range ids {
+					list = append(list, pod.Match{Feed: f, Episode: f.Episodes[id]})
+				}
+			} else if q, ok := store.Smart[playlist]; ok {
+				// Smart playlists span every feed unless one is selected
+				feeds := store.Feeds
+				if cmd.Flags().Changed("feed") {
+					feeds = pod.Feeds{f}
+				}
+				if list, err = q.Run(feeds); err != nil {
+					fmt.Println(err)
+					return
 				}
-				return
 			} else {
 				fmt.Printf("invalid playlist: [%s]", playlist)
 				return
 			}
-		}
 
-		if episodes != "" {
-			for _, ep := range store.Feeds[feed].Set(episodes) {
-				play(ep, feedTitle, speed, true)
+		case episodes != "":
+			// Episodes picked out by id are played whatever the skip rules say
+			bonus = true
+			for _, ep := range f.Set(episodes) {
+				list = append(list, pod.Match{Feed: f, Episode: ep})
 			}
-			return
-		}
 
-		for _, ep := range store.Feeds[feed].Episodes {
-			play(ep, feedTitle, speed, true)
+		default:
+			for _, ep := range f.Ordered() {
+				list = append(list, pod.Match{Feed: f, Episode: ep})
+			}
 		}
+
+		playList(list, speed, !bonus)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(playCmd)
 
-	playCmd.Flags().IntP("feed", "f", 0, "Play feed, by default episodes marked played are ignored")
-	playCmd.Flags().StringP("playlist", "l", "", "Play a saved playlist")
+	playCmd.Flags().StringP("feed", "f", "", "Play feed, the most recently updated by default. Episodes marked played are ignored")
+	playCmd.Flags().StringP("playlist", "l", "", "Play a saved playlist or smart playlist")
 	playCmd.Flags().Float32P("speed", "s", 1.0, "Play speed. Accepts values from 0.01 to 100")
 	playCmd.Flags().StringP("episodes", "e", "", "Play selected episodes as a range (0-10) or a comma separated set (3,5,6). No spaces")
+	playCmd.Flags().BoolP("queue", "q", false, "Play through the queue, removing episodes as they finish")
+	playCmd.Flags().IntP("chapter", "c", 0, "Start the first episode played at this chapter")
+	playCmd.Flags().BoolP("include-bonus", "b", false, "Play episodes the feed's skip rules would leave out")
+}
+
+// startChapter is the chapter the next episode played starts at, -1 to resume
+// where it was left off
+var startChapter = -1
+
+// skip is a request to move through a list of episodes before the current
+// one has finished
+type skip int32
+
+const (
+	skipNone skip = iota
+	skipNext
+	skipPrevious
+)
+
+// playList plays episodes in order, skipping those already played unless
+// they're gone back to. If skipRules is set episodes left out by their feed's
+// skip rules aren't played at all.
+func playList(list []pod.Match, playSpeed float32, skipRules bool) {
+	for i, back := 0, false; i >= 0 && i < len(list); {
+		m := list[i]
+		if skipRules && m.Feed.Skipped(m.Episode) {
+			if back {
+				i--
+			} else {
+				i++
+			}
+			continue
+		}
+
+		switch play(m.Feed, m.Episode, playSpeed, !back, i < len(list)-1, i > 0) {
+		case skipPrevious:
+			i, back = i-1, true
+		default:
+			i, back = i+1, false
+		}
+	}
 }
 
-func play(ep *pod.Episode, feedTitle string, playSpeed float32, skipPlayed bool) {
+// playQueue plays the queue from the front. The queue is re-read after every
+// episode so changes made while listening are picked up.
+func playQueue(playSpeed float32) {
+	for i := 0; i >= 0 && i < len(store.Queue); {
+		it := store.Queue[i]
+
+		f, ep := store.Queued(it)
+		if ep != nil {
+			switch play(f, ep, playSpeed, false, i < len(store.Queue)-1, i > 0) {
+			case skipNext:
+				i++
+				continue
+			case skipPrevious:
+				i--
+				continue
+			}
+		}
+
+		// play exits if it's interrupted, so only finished episodes are removed
+		if err := store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Remove(it) }); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// play an episode. If another program asks to skip to the next or previous
+// episode over MPRIS, and there is one, play stops and returns which. If
+// playback is interrupted yapa exits once the position is saved.
+func play(f *pod.Feed, ep *pod.Episode, playSpeed float32, skipPlayed, hasNext, hasPrevious bool) skip {
 	if skipPlayed && ep.Played {
-		return
+		return skipNone
 	}
 
+	feedTitle := f.DisplayTitle()
+
 	if showNotify {
 		go sendNotify(feedTitle, ep.Title)
 	}
@@ -100,14 +205,17 @@ func play(ep *pod.Episode, feedTitle string, playSpeed float32, skipPlayed bool)
 	tput(hideCursor)
 	defer tput(showCursor)
 
-	args := []string{
-		"--no-video",
-		ep.Mp3,
-		fmt.Sprintf("--speed=%.2f", playSpeed),
-	}
-	if ep.Elapsed > 0 {
-		args = append(args, fmt.Sprintf("--start=%d", ep.Elapsed))
-
+	loadChapters(f, ep)
+	cues := loadCues(ep)
+	if startChapter >= 0 {
+		if startChapter >= len(ep.Chapters) {
+			tput(showCursor)
+			fmt.Printf("%s has %d chapters\n", ep.Title, len(ep.Chapters))
+			os.Exit(1)
+		}
+		ep.Elapsed = int(ep.Chapters[startChapter].Start)
+		startChapter = -1
+	} else if ep.Elapsed > 0 {
 		for _, i := range []int{3, 2, 1} {
 			clear()
 			fmt.Fprintf(tw, "Feed:\t%s\nPlaying:\t%s\n-> Resuming at %s in %d",
@@ -116,53 +224,185 @@ func play(ep *pod.Episode, feedTitle string, playSpeed float32, skipPlayed bool)
 			time.Sleep(time.Second * 1)
 		}
 	}
-	cmd := exec.Command("mpv", args...)
 
-	if err := cmd.Start(); err != nil {
+	p, err := player.New(viper.GetString("player"))
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Record time elapsed and catch kill signal
-	done := make(chan bool, 1)
-	defer close(done)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}...)
+	defer signal.Stop(sig)
+
+	if err := p.Start(ep.Source(), ep.Elapsed, float64(playSpeed)); err != nil {
+		tput(showCursor)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var (
+		skipTo   atomic.Int32
+		handlers mpris.Handlers
+		srv      *mpris.Server
+		tried    bool
+	)
+	if hasNext {
+		handlers.Next = func() { skipTo.Store(int32(skipNext)); p.Stop() }
+	}
+	if hasPrevious {
+		handlers.Previous = func() { skipTo.Store(int32(skipPrevious)); p.Stop() }
+	}
+
+	// Keys control the player until it exits
+	restore := cbreak()
+	defer restore()
 
+	stopKeys := make(chan bool)
 	go func() {
-		tick := time.NewTicker(time.Second)
-		defer tick.Stop()
+		for {
+			select {
+			case k := <-readKeys():
+				switch k {
+				case ' ':
+					p.Pause(!p.Status().Paused)
+				case ']':
+					seekChapter(p, ep.Chapters, 1)
+				case '[':
+					seekChapter(p, ep.Chapters, -1)
+				}
+			case <-stopKeys:
+				return
+			}
+		}
+	}()
+
+	st, err := listen(p, sig, func(st player.Status) {
+		// The player has to be running before it can be controlled
+		if !tried && viper.GetBool("mpris") {
+			tried = true
+			srv, _ = mpris.Start(p, mpris.Metadata{
+				ID:      f.RSS + ep.Key(),
+				Feed:    feedTitle,
+				Title:   ep.Title,
+				Artwork: ep.Artwork(f),
+				URL:     ep.Source(),
+				Length:  float64(ep.Duration),
+			}, handlers)
+		}
+		if srv != nil {
+			srv.Update(st)
+		}
+
+		clear()
+		fmt.Fprintf(tw, "Feed:\t%s\nPlaying:\t%s\nElapsed:\t%s\n",
+			feedTitle, ep.Title, playStatus(st))
+		if caption := cues.At(st.Position); caption != "" {
+			fmt.Fprintf(tw, "Caption:\t%s\n", caption)
+		}
+		if len(ep.Chapters) > 0 {
+			fmt.Fprintf(tw, "Chapter:\t%s\n\n[ and ] skip chapters, space pauses\n", chapterStatus(ep.Chapters, st.Position))
+		}
+		tw.Flush()
+	})
+	close(stopKeys)
+	if srv != nil {
+		srv.Close()
+	}
+
+	// Keep the resume point however the player exited
+	finished := applyStatus(ep, st)
+	store.SaveEpisode(f, ep)
+	if err != nil {
+		tput(showCursor)
+		restore()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if finished {
+		return skipNone
+	}
+	if s := skip(skipTo.Load()); s != skipNone {
+		return s
+	}
+
+	tput(showCursor)
+	restore()
+	os.Exit(0)
+	return skipNone
+}
 
-		sig := make(chan os.Signal, 1)
-		defer close(sig)
+// listen waits for p, which must have been started, to exit. show is called
+// with the player's status once a second and a signal on stop stops the
+// player. listen doesn't touch the episode that's playing, callers pass the
+// status it returns to applyStatus wherever it's safe for them to change it.
+func listen(p player.Player, stop <-chan os.Signal, show func(player.Status)) (player.Status, error) {
+	var (
+		done    = make(chan bool)
+		stopped = make(chan bool)
+	)
 
-		signal.Notify(sig, []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}...)
-		defer signal.Stop(sig)
+	go func() {
+		defer close(stopped)
+
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
 
 		for {
 			select {
 			case <-tick.C:
-				ep.Elapsed++
-				clear()
-				fmt.Fprintf(tw, "Feed:\t%s\nPlaying:\t%s\nElapsed:\t%s",
-					feedTitle, ep.Title, pod.ParseElapsed(ep.Elapsed))
-				tw.Flush()
+				show(p.Status())
 			case <-done:
 				return
-			case s := <-sig:
-				cmd.Process.Signal(s)
-				return
+			case <-stop:
+				p.Stop()
 			}
 		}
 	}()
 
-	if err := cmd.Wait(); err != nil {
-		pod.WriteStore(store)
-		tput(showCursor)
-		os.Exit(0)
+	err := p.Wait()
+	close(done)
+	<-stopped
+
+	st := p.Status()
+	if st.EOF {
+		// Reaching the end is all that matters, however the player exited
+		return st, nil
 	}
 
-	// Tidy up if the epsiode is played completely
-	done <- true
+	return st, err
+}
 
-	ep.Played = true
+// applyStatus records the player's status on ep. ep.Elapsed follows the
+// position reported by the player and if the episode has played to the end it
+// is marked played, its resume point is cleared and applyStatus returns true.
+func applyStatus(ep *pod.Episode, st player.Status) bool {
+	if st.Started {
+		ep.Elapsed = int(st.Position)
+	}
+
+	if !st.EOF {
+		return false
+	}
+
+	// Tidy up if the epsiode is played completely
+	ep.MarkPlayed(true)
 	ep.Elapsed = 0
-	pod.WriteStore(store)
+	return true
+}
+
+// playStatus formats the player's position for display
+func playStatus(st player.Status) string {
+	out := pod.ParseElapsed(int(st.Position))
+	if st.Duration > 0 {
+		out += " / " + pod.ParseElapsed(int(st.Duration))
+	}
+	if st.Speed > 0 && st.Speed != 1 {
+		out += fmt.Sprintf(" (%.2fx)", st.Speed)
+	}
+	if st.Paused {
+		out += " [paused]"
+	}
+
+	return out
 }
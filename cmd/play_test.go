@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/nboughton/yapa/player"
+	"github.com/nboughton/yapa/pod"
+)
+
+// fakePlayer stands in for an external player. It plays until Stop is called
+// or, if end is set, exits straight away in the state given by end.
+type fakePlayer struct {
+	mu     sync.Mutex
+	status player.Status
+	start  int
+	end    *player.Status
+	err    error
+	exit   chan bool
+}
+
+func (f *fakePlayer) Start(source string, start int, speed float64) error {
+	f.start = start
+	f.exit = make(chan bool)
+	f.status = player.Status{Position: float64(start), Speed: speed, Started: true}
+	if f.end != nil {
+		f.status = *f.end
+		close(f.exit)
+	}
+	return nil
+}
+
+func (f *fakePlayer) Status() player.Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.status
+}
+
+func (f *fakePlayer) Pause(paused bool) error      { return nil }
+func (f *fakePlayer) SetSpeed(speed float64) error { return nil }
+func (f *fakePlayer) Seek(position float64) error  { return nil }
+
+func (f *fakePlayer) Stop() error {
+	f.mu.Lock()
+	f.status.Position += 10
+	f.mu.Unlock()
+
+	close(f.exit)
+	return nil
+}
+
+func (f *fakePlayer) Wait() error {
+	<-f.exit
+	return f.err
+}
+
+func TestListen(t *testing.T) {
+	fail := errors.New("player crashed")
+
+	tests := []struct {
+		name         string
+		end          *player.Status
+		err          error
+		stop         bool
+		wantFinished bool
+		wantErr      error
+		wantElapsed  int
+		wantPlayed   bool
+	}{
+		{
+			name:        "stopped",
+			stop:        true,
+			wantElapsed: 130,
+		},
+		{
+			name:         "end of file",
+			end:          &player.Status{Position: 600, Duration: 600, Started: true, EOF: true},
+			wantFinished: true,
+			wantElapsed:  0,
+			wantPlayed:   true,
+		},
+		{
+			name:        "exited early",
+			end:         &player.Status{Position: 300, Duration: 600, Started: true},
+			wantElapsed: 300,
+		},
+		{
+			name:        "error",
+			end:         &player.Status{Position: 200, Duration: 600, Started: true},
+			err:         fail,
+			wantErr:     fail,
+			wantElapsed: 200,
+		},
+		{
+			name:        "error before playback started",
+			end:         &player.Status{},
+			err:         fail,
+			wantErr:     fail,
+			wantElapsed: 120,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				ep   = &pod.Episode{Title: "Episode", Mp3: "http://example.com/ep.mp3", Elapsed: 120}
+				p    = &fakePlayer{end: tt.end, err: tt.err}
+				stop = make(chan os.Signal, 1)
+			)
+			if tt.stop {
+				stop <- syscall.SIGINT
+			}
+
+			if err := p.Start(ep.Source(), ep.Elapsed, 1); err != nil {
+				t.Fatal(err)
+			}
+			st, err := listen(p, stop, func(player.Status) {})
+			finished := applyStatus(ep, st)
+			if finished != tt.wantFinished {
+				t.Errorf("finished = %v, want %v", finished, tt.wantFinished)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if p.start != 120 {
+				t.Errorf("player started at %d, want the resume point 120", p.start)
+			}
+			if ep.Elapsed != tt.wantElapsed {
+				t.Errorf("Elapsed = %d, want %d", ep.Elapsed, tt.wantElapsed)
+			}
+			if ep.Played != tt.wantPlayed {
+				t.Errorf("Played = %v, want %v", ep.Played, tt.wantPlayed)
+			}
+		})
+	}
+}
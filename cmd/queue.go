@@ -0,0 +1,201 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/nboughton/yapa/pod"
+	"github.com/spf13/cobra"
+)
+
+// queueCmd represents the queue command
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Manage the listening queue",
+	Long: `The queue is a list of episodes from any feed to be played in order with
+yapa play --queue. Episodes are removed from the queue once they've been played
+to the end.`,
+}
+
+// queueListCmd represents the queue list command
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the queue",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(store.Queue) == 0 {
+			fmt.Println("The queue is empty.")
+			return
+		}
+
+		fmt.Fprint(tw, "Pos\tFeed\tEpisode\tName\tPlayed\tElapsed\n")
+		for i, it := range store.Queue {
+			f, ep := store.Queued(it)
+			if ep == nil {
+				fmt.Fprintf(tw, "%d\t\t\t%s [no longer in store]\t\t\n", i, it.Episode)
+				continue
+			}
+
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\n", i, f.DisplayTitle(), ep.ID, episodeTitle(ep), played(ep.Played), pod.ParseElapsed(ep.Elapsed))
+		}
+		tw.Flush()
+	},
+}
+
+// queueAddCmd represents the queue add command
+var queueAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add episodes to the end of the queue",
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			episodes, _ = cmd.Flags().GetString("episodes")
+			playlist, _ = cmd.Flags().GetString("playlist")
+		)
+
+		feed, err := feedFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if feed < 0 {
+			fmt.Println("Please specify a feed.")
+			return
+		}
+
+		f := store.Feeds[feed]
+
+		var eps pod.Episodes
+		switch {
+		case episodes != "":
+			eps = f.Set(episodes)
+		case playlist != "":
+			eps = f.Playlist(playlist)
+		default:
+			fmt.Println("Please specify episodes or a playlist to queue.")
+			return
+		}
+
+		var items pod.Queue
+		for _, ep := range eps {
+			items = append(items, pod.NewQueueItem(f, ep))
+		}
+
+		if err := store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Add(items...) }); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Queued %d episodes, %d in the queue\n", len(items), len(store.Queue))
+	},
+}
+
+// queueRemoveCmd represents the queue remove command
+var queueRemoveCmd = &cobra.Command{
+	Use:   "remove <pos>...",
+	Short: "Remove episodes from the queue by their position",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var items pod.Queue
+		for _, a := range args {
+			pos, err := queuePos(a)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			items = append(items, store.Queue[pos])
+		}
+
+		if err := store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Remove(items...) }); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Removed %d episodes, %d in the queue\n", len(items), len(store.Queue))
+	},
+}
+
+// queueMoveCmd represents the queue move command
+var queueMoveCmd = &cobra.Command{
+	Use:   "move <from> <to>",
+	Short: "Move an episode to a new position in the queue",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		from, err := queuePos(args[0])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		to, err := queuePos(args[1])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		it := store.Queue[from]
+		err = store.UpdateQueue(func(q pod.Queue) pod.Queue {
+			// Another yapa may have changed the queue since we read it
+			return q.Move(q.Index(it), to)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		queueListCmd.Run(cmd, nil)
+	},
+}
+
+// queueClearCmd represents the queue clear command
+var queueClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every episode from the queue",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Print("Clear the queue, ")
+		if confirm() {
+			if err := store.UpdateQueue(func(pod.Queue) pod.Queue { return pod.Queue{} }); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println("Queue cleared.")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queueCmd)
+	queueCmd.AddCommand(queueListCmd)
+	queueCmd.AddCommand(queueAddCmd)
+	queueCmd.AddCommand(queueRemoveCmd)
+	queueCmd.AddCommand(queueMoveCmd)
+	queueCmd.AddCommand(queueClearCmd)
+
+	queueAddCmd.Flags().StringP("feed", "f", "", "Feed to queue episodes from")
+	queueAddCmd.Flags().StringP("episodes", "e", "", "Queue selected episodes as a range (0-10) or a comma separated set (3,5,6). No spaces")
+	queueAddCmd.Flags().StringP("playlist", "l", "", "Queue a saved playlist")
+}
+
+// queuePos parses a position in the queue
+func queuePos(s string) (int, error) {
+	pos, err := strconv.Atoi(s)
+	if err != nil || pos < 0 || pos >= len(store.Queue) {
+		return 0, fmt.Errorf("invalid queue position: [%s]", s)
+	}
+
+	return pos, nil
+}
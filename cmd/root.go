@@ -30,6 +30,7 @@ import (
 	"github.com/esiqveland/notify"
 	"github.com/godbus/dbus/v5"
 	homedir "github.com/mitchellh/go-homedir"
+	"github.com/nboughton/yapa/player"
 	"github.com/nboughton/yapa/pod"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -46,7 +47,10 @@ var (
 
 	defaultConf = `{
 		"store": "~/.config/yapa/store.json",
-		"notify": true
+		"notify": true,
+		"backups": 5,
+		"library": "~/Podcasts",
+		"player": "mpv"
 	}`
 )
 
@@ -62,15 +66,20 @@ var rootCmd = &cobra.Command{
 	Long:  ``,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		var err error
-		store, err = pod.ReadStore(viper.GetString("store"))
+		store, err = pod.ReadStore(viper.GetString("store"), viper.GetInt("backups"))
 		if err != nil && err.Error() == pod.ErrorInvalidPath {
 			log.Fatal(err)
 		} else if err != nil && err.Error() == pod.ErrorStoreDoesNotExist {
 			fmt.Println("No store found, creating blank db...")
+		} else if err != nil {
+			log.Fatal(err)
 		}
 
 		showNotify = viper.GetBool("notify")
 	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		store.Close()
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
@@ -113,23 +122,31 @@ func initConfig() {
 	}
 
 	viper.AutomaticEnv() // read in environment variables that match
+	viper.SetDefault("backups", 5)
+	viper.SetDefault("library", "~/Podcasts")
+	viper.SetDefault("player", player.Default)
+	viper.SetDefault("mpris", true)
+	viper.SetDefault("transcripts", "~/.cache/yapa/transcripts")
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("")
+		// Spacing only, keep stdout clean for list --output
+		fmt.Fprintln(os.Stderr)
 	} else {
 		fmt.Printf("No config file found. Please create a config at ~/config/yapa/config.json with the following format:\n%s", defaultConf)
 		os.Exit(1)
 	}
 }
 
-// Check feed id
-func validFeed(id int) error {
-	if id >= len(store.Feeds) {
-		return fmt.Errorf("no feed with id %d", id)
+// feedFlag resolves the --feed flag, which can be a feed's ID, slug or (part
+// of) its title, to the feed's ID. It returns -1 if the flag wasn't given.
+func feedFlag(cmd *cobra.Command) (int, error) {
+	name, _ := cmd.Flags().GetString("feed")
+	if name == "" {
+		return -1, nil
 	}
 
-	return nil
+	return store.FindFeed(name)
 }
 
 // clear terminal screen
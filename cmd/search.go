@@ -0,0 +1,193 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nboughton/yapa/pod"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search <phrase>",
+	Short: "Search episode titles or transcripts",
+	Long: `Search episode titles, or with --transcripts what's said in episodes that
+publish a transcript. Matching is case insensitive. Transcripts are fetched the
+first time they're searched and cached in the directory set by the transcripts
+config key (~/.cache/yapa/transcripts by default).
+
+Use --play with the number of a result to play it from the matching line.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			inText, _ = cmd.Flags().GetBool("transcripts")
+			cached, _ = cmd.Flags().GetBool("cached")
+			playN, _  = cmd.Flags().GetInt("play")
+			speed, _  = cmd.Flags().GetFloat32("speed")
+			phrase    = strings.ToLower(strings.Join(args, " "))
+			feeds     = store.Feeds
+			results   []searchResult
+		)
+
+		feed, err := feedFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if feed >= 0 {
+			feeds = pod.Feeds{store.Feeds[feed]}
+		}
+		for _, f := range feeds {
+			for _, ep := range f.Episodes {
+				if !inText {
+					if strings.Contains(strings.ToLower(ep.Title), phrase) {
+						results = append(results, searchResult{f: f, ep: ep, at: -1})
+					}
+					continue
+				}
+
+				t, ok := ep.Transcript()
+				if !ok || (cached && !t.Cached(viper.GetString("transcripts"))) {
+					continue
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				cues, err := t.Cues(ctx, viper.GetString("transcripts"))
+				cancel()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s: %s\n", f.DisplayTitle(), ep.Title, err)
+					continue
+				}
+
+				for _, cue := range cues {
+					if strings.Contains(strings.ToLower(cue.Text), phrase) {
+						at := cue.Start
+						if !cues.Timed() {
+							at = -1
+						}
+						results = append(results, searchResult{f: f, ep: ep, at: at, text: cue.Text})
+					}
+				}
+			}
+		}
+
+		if playN >= 0 {
+			if playN >= len(results) {
+				fmt.Printf("invalid result: [%d], there are %d results\n", playN, len(results))
+				return
+			}
+
+			r := results[playN]
+			if r.at >= 0 {
+				r.ep.Elapsed = int(r.at)
+			}
+			play(r.f, r.ep, speed, false, false, false)
+			return
+		}
+
+		fmt.Fprint(tw, "#\tFeed\tID\tEpisode\tAt\tLine\n")
+		for i, r := range results {
+			at := "-"
+			if r.at >= 0 {
+				at = pod.ParseElapsed(int(r.at))
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\n", i, r.f.DisplayTitle(), r.ep.ID, r.ep.Title, at, snippet(r.text, phrase, 60))
+		}
+		tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().StringP("feed", "f", "", "Only search this feed")
+	searchCmd.Flags().BoolP("transcripts", "t", false, "Search transcripts instead of titles")
+	searchCmd.Flags().Bool("cached", false, "Only search transcripts that have already been fetched")
+	searchCmd.Flags().IntP("play", "p", -1, "Play a result, starting at the matching line")
+	searchCmd.Flags().Float32P("speed", "s", 1.0, "Play speed. Accepts values from 0.01 to 100")
+}
+
+// loadCues loads the transcript of an episode to show captions while it
+// plays. Episodes without a timed transcript have no cues.
+func loadCues(ep *pod.Episode) pod.Cues {
+	t, ok := ep.Transcript()
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cues, err := t.Cues(ctx, viper.GetString("transcripts"))
+	if err != nil || !cues.Timed() {
+		return nil
+	}
+
+	return cues
+}
+
+// searchResult is an episode, and where in it, that matched a search. at is
+// -1 if the match has no timestamp.
+type searchResult struct {
+	f    *pod.Feed
+	ep   *pod.Episode
+	at   float64
+	text string
+}
+
+// snippet shortens s to about width characters around the first match of
+// phrase
+func snippet(s, phrase string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+
+	i := strings.Index(strings.ToLower(s), phrase)
+	if i < 0 || i > len(s) {
+		i = 0
+	}
+
+	start := len([]rune(s[:i])) - width/3
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(r) {
+		end, start = len(r), max(len(r)-width, 0)
+	}
+
+	out := string(r[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(r) {
+		out += "…"
+	}
+	return out
+}
@@ -0,0 +1,872 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nboughton/yapa/player"
+	"github.com/nboughton/yapa/pod"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run yapa in the background with an HTTP/JSON API",
+	Long: `serve keeps the store open and exposes it, along with playback, over HTTP.
+--listen takes a host:port or, prefixed with unix:, the path of a Unix socket.
+If serve_token is set in the config (or --token is given) every request must
+send it as "Authorization: Bearer <token>". Set one before listening on
+anything other than localhost. A {feed} can be a feed's ID, slug or title, in
+paths and request bodies alike.
+
+  GET    /feeds                                 list feeds
+  GET    /feeds/{feed}                          feed summary
+  GET    /feeds/{feed}/episodes[?playlist=name] list episodes
+  GET    /feeds/{feed}/episodes/{episode}       episode details
+  PUT    /feeds/{feed}/episodes/{episode}/played  {"played": true}
+  POST   /update[?force=true]                   refresh every feed
+  GET    /queue                                 list the queue
+  POST   /queue                                 {"feed": 0, "episode": 3}
+  POST   /queue/move                            {"from": 2, "to": 0}
+  DELETE /queue/{pos}                           remove an episode from the queue
+  DELETE /queue                                 clear the queue
+  GET    /player                                playback status
+  POST   /player/play                           {"feed": 0, "episode": 3} or {"queue": true}
+  POST   /player/pause, /player/resume, /player/stop
+  POST   /player/seek                           {"position": 120}
+  POST   /player/chapter                        {"chapter": 2}
+  POST   /player/speed                          {"speed": 1.5}`,
+	Run: func(cmd *cobra.Command, args []string) {
+		addr := viper.GetString("serve_listen")
+
+		ln, err := serveListener(addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s := &server{token: viper.GetString("serve_token"), speed: 1}
+		srv := &http.Server{Handler: s.routes()}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		go func() {
+			<-ctx.Done()
+
+			// Save the position of anything that's playing before exiting.
+			// Neither lock is released so nothing else can happen meanwhile.
+			s.ctl.Lock()
+			s.stopPlaying()
+			s.mu.Lock()
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdown)
+		}()
+
+		fmt.Printf("Listening on %s\n", addr)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringP("listen", "l", "127.0.0.1:8686", "Address to listen on, host:port or unix:/path/to/socket")
+	serveCmd.Flags().String("token", "", "Require API requests to send this bearer token")
+
+	viper.BindPFlag("serve_listen", serveCmd.Flags().Lookup("listen"))
+	viper.BindPFlag("serve_token", serveCmd.Flags().Lookup("token"))
+}
+
+// serveListener listens on a TCP address or, for addresses starting with
+// unix:, a Unix socket that only the current user can connect to
+func serveListener(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// Clear up a socket left behind by a previous run
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ln, os.Chmod(path, 0600)
+}
+
+// server owns the store while yapa serve is running. Every request holds mu
+// for as long as it uses the store. Starting and stopping playback also holds
+// ctl throughout, so the episode that's playing can be saved in between.
+type server struct {
+	mu    sync.Mutex
+	ctl   sync.Mutex
+	token string
+	speed float64
+
+	// Playback state, p is nil when nothing is playing
+	p         player.Player
+	stop      chan os.Signal
+	done      chan bool // Closed once the playing episode has been saved
+	feed      *pod.Feed
+	ep        *pod.Episode
+	fromQueue bool
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /feeds", s.listFeeds)
+	mux.HandleFunc("GET /feeds/{feed}", s.getFeed)
+	mux.HandleFunc("GET /feeds/{feed}/episodes", s.listEpisodes)
+	mux.HandleFunc("GET /feeds/{feed}/episodes/{episode}", s.getEpisode)
+	mux.HandleFunc("PUT /feeds/{feed}/episodes/{episode}/played", s.markPlayed)
+	mux.HandleFunc("POST /update", s.update)
+
+	mux.HandleFunc("GET /queue", s.listQueue)
+	mux.HandleFunc("POST /queue", s.addQueue)
+	mux.HandleFunc("POST /queue/move", s.moveQueue)
+	mux.HandleFunc("DELETE /queue/{pos}", s.removeQueue)
+	mux.HandleFunc("DELETE /queue", s.clearQueue)
+
+	mux.HandleFunc("GET /player", s.playerStatus)
+	mux.HandleFunc("POST /player/play", s.play)
+	mux.HandleFunc("POST /player/pause", s.pause(true))
+	mux.HandleFunc("POST /player/resume", s.pause(false))
+	mux.HandleFunc("POST /player/stop", s.stopPlayer)
+	mux.HandleFunc("POST /player/seek", s.seek)
+	mux.HandleFunc("POST /player/chapter", s.chapter)
+	mux.HandleFunc("POST /player/speed", s.setSpeed)
+
+	return s.auth(mux)
+}
+
+// auth checks requests for the bearer token, if one is set
+func (s *server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+			apiError(w, http.StatusUnauthorized, fmt.Errorf("invalid or missing token"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func apiError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// readJSON decodes the request body into v
+func readJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %s", err)
+	}
+
+	return nil
+}
+
+// feedParam looks up the feed in the request path
+func feedParam(r *http.Request) (int, *pod.Feed, error) {
+	id, err := store.FindFeed(r.PathValue("feed"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return id, store.Feeds[id], nil
+}
+
+// feedRef is a feed in a request body, either its ID or its slug or title
+type feedRef string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (ref *feedRef) UnmarshalJSON(data []byte) error {
+	var id int
+	if err := json.Unmarshal(data, &id); err == nil {
+		*ref = feedRef(strconv.Itoa(id))
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("feed must be an ID or a name")
+	}
+	*ref = feedRef(name)
+	return nil
+}
+
+// episodeParam looks up the feed and episode in the request path
+func episodeParam(r *http.Request) (*pod.Feed, *pod.Episode, error) {
+	_, f, err := feedParam(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := strconv.Atoi(r.PathValue("episode"))
+	if err != nil || id < 0 || id >= len(f.Episodes) {
+		return nil, nil, fmt.Errorf("no episode with id %s", r.PathValue("episode"))
+	}
+
+	return f, f.Episodes[id], nil
+}
+
+func (s *server) listFeeds(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := []feedRecord{}
+	for i, f := range store.Feeds {
+		out = append(out, newFeedRecord(i, f))
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *server) getFeed(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, f, err := feedParam(r)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newFeedRecord(id, f))
+}
+
+func (s *server) listEpisodes(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, f, err := feedParam(r)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+
+	eps := f.Ordered()
+	if name := r.URL.Query().Get("playlist"); name != "" {
+		if _, ok := f.Playlists[name]; ok {
+			eps = f.Playlist(name)
+		} else if q, ok := store.Smart[name]; ok {
+			if eps, err = q.Episodes(f); err != nil {
+				apiError(w, http.StatusInternalServerError, err)
+				return
+			}
+		} else {
+			apiError(w, http.StatusNotFound, fmt.Errorf("invalid playlist: [%s]", name))
+			return
+		}
+	}
+
+	out := []episodeRecord{}
+	for _, ep := range eps {
+		out = append(out, episodeRecord{Feed: f.DisplayTitle(), Episode: ep})
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *server) getEpisode(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ep, err := episodeParam(r)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, episodeRecord{Feed: f.DisplayTitle(), Episode: ep})
+}
+
+func (s *server) markPlayed(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ep, err := episodeParam(r)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return
+	}
+
+	var body struct {
+		Played bool `json:"played"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ep.MarkPlayed(body.Played)
+	if err := store.SaveFeed(f); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, episodeRecord{Feed: f.DisplayTitle(), Episode: ep})
+}
+
+// update refreshes every feed. Feeds are fetched into a copy of the store so
+// other requests aren't held up, the store is only locked to merge them back.
+func (s *server) update(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	snap := store.Snapshot()
+	s.mu.Unlock()
+
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	results := snap.Update(pod.UpdateOptions{
+		Workers: viper.GetInt("update_workers"),
+		PerHost: viper.GetInt("update_host_limit"),
+		Timeout: time.Duration(viper.GetInt("update_timeout")) * time.Second,
+		Force:   force,
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := store.Merge(snap); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type result struct {
+		Feed        string `json:"feed"`
+		NewEpisodes int    `json:"new_episodes"`
+		Error       string `json:"error,omitempty"`
+	}
+
+	out := []result{}
+	for _, res := range results {
+		rr := result{Feed: res.Feed.DisplayTitle(), NewEpisodes: res.NewEpisodes}
+		if res.Err != nil && !errors.Is(res.Err, pod.ErrNotModified) && !errors.Is(res.Err, pod.ErrCached) {
+			rr.Error = res.Err.Error()
+		}
+		out = append(out, rr)
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// queueRecord is a queued episode as it's returned by the API
+type queueRecord struct {
+	Position int `json:"position"`
+	pod.QueueItem
+	Title string `json:"title,omitempty"` // Empty if the episode is no longer in the store
+}
+
+func (s *server) queue() []queueRecord {
+	out := []queueRecord{}
+	for i, it := range store.Queue {
+		qr := queueRecord{Position: i, QueueItem: it}
+		if _, ep := store.Queued(it); ep != nil {
+			qr.Title = ep.Title
+		}
+		out = append(out, qr)
+	}
+
+	return out
+}
+
+func (s *server) listQueue(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, s.queue())
+}
+
+func (s *server) addQueue(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var body struct {
+		Feed    feedRef `json:"feed"`
+		Episode int     `json:"episode"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	id, err := store.FindFeed(string(body.Feed))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	f := store.Feeds[id]
+	if body.Episode < 0 || body.Episode >= len(f.Episodes) {
+		apiError(w, http.StatusBadRequest, fmt.Errorf("no episode with id %d", body.Episode))
+		return
+	}
+
+	it := pod.NewQueueItem(f, f.Episodes[body.Episode])
+	if err := store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Add(it) }); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.queue())
+}
+
+func (s *server) moveQueue(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var body struct {
+		From int `json:"from"`
+		To   int `json:"to"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.From < 0 || body.From >= len(store.Queue) {
+		apiError(w, http.StatusBadRequest, fmt.Errorf("invalid queue position: [%d]", body.From))
+		return
+	}
+
+	if err := store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Move(body.From, body.To) }); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.queue())
+}
+
+func (s *server) removeQueue(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, err := strconv.Atoi(r.PathValue("pos"))
+	if err != nil || pos < 0 || pos >= len(store.Queue) {
+		apiError(w, http.StatusNotFound, fmt.Errorf("invalid queue position: [%s]", r.PathValue("pos")))
+		return
+	}
+
+	it := store.Queue[pos]
+	if err := store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Remove(it) }); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.queue())
+}
+
+func (s *server) clearQueue(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := store.UpdateQueue(func(pod.Queue) pod.Queue { return pod.Queue{} }); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.queue())
+}
+
+// playerRecord is the playback status returned by the API
+type playerRecord struct {
+	Playing   bool    `json:"playing"`
+	Feed      string  `json:"feed,omitempty"`
+	Episode   string  `json:"episode,omitempty"`
+	Position  float64 `json:"position"`
+	Duration  float64 `json:"duration"`
+	Paused    bool    `json:"paused"`
+	Speed     float64 `json:"speed"`
+	FromQueue bool    `json:"from_queue"`
+
+	// Chapter playing, if the episode has chapters
+	Chapter      *int   `json:"chapter,omitempty"`
+	ChapterTitle string `json:"chapter_title,omitempty"`
+}
+
+// status of playback, s.mu must be held
+func (s *server) status() playerRecord {
+	if s.p == nil {
+		return playerRecord{Speed: s.speed}
+	}
+
+	st := s.p.Status()
+	if st.Speed == 0 {
+		// The player hasn't reported a speed yet
+		st.Speed = s.speed
+	}
+
+	out := playerRecord{
+		Playing:   true,
+		Feed:      s.feed.DisplayTitle(),
+		Episode:   s.ep.Title,
+		Position:  st.Position,
+		Duration:  st.Duration,
+		Paused:    st.Paused,
+		Speed:     st.Speed,
+		FromQueue: s.fromQueue,
+	}
+	if i := s.ep.Chapters.At(st.Position); i >= 0 {
+		out.Chapter, out.ChapterTitle = &i, s.ep.Chapters[i].Title
+	}
+
+	return out
+}
+
+func (s *server) playerStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// play starts an episode, the next unplayed episode of a feed or the queue.
+// Anything already playing is stopped and saved first.
+func (s *server) play(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Feed    *feedRef `json:"feed"`
+		Episode *int     `json:"episode"`
+		Queue   bool     `json:"queue"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	s.stopPlaying()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		f  *pod.Feed
+		ep *pod.Episode
+	)
+	switch {
+	case body.Queue:
+		f, ep = s.nextQueued()
+		if ep == nil {
+			apiError(w, http.StatusBadRequest, fmt.Errorf("the queue is empty"))
+			return
+		}
+
+	case body.Feed != nil:
+		id, err := store.FindFeed(string(*body.Feed))
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+		f = store.Feeds[id]
+
+		if body.Episode != nil {
+			if *body.Episode < 0 || *body.Episode >= len(f.Episodes) {
+				apiError(w, http.StatusBadRequest, fmt.Errorf("no episode with id %d", *body.Episode))
+				return
+			}
+			ep = f.Episodes[*body.Episode]
+		} else {
+			for _, e := range f.Ordered() {
+				if !e.Played && !f.Skipped(e) {
+					ep = e
+					break
+				}
+			}
+			if ep == nil {
+				apiError(w, http.StatusBadRequest, fmt.Errorf("every episode of %s has been played", f.DisplayTitle()))
+				return
+			}
+		}
+
+	default:
+		apiError(w, http.StatusBadRequest, fmt.Errorf("please specify a feed or the queue"))
+		return
+	}
+
+	if err := s.start(f, ep, body.Queue); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// nextQueued returns the first episode in the queue that's still in the
+// store, s.mu must be held
+func (s *server) nextQueued() (*pod.Feed, *pod.Episode) {
+	for _, it := range store.Queue {
+		if f, ep := store.Queued(it); ep != nil {
+			return f, ep
+		}
+	}
+
+	return nil, nil
+}
+
+// start playing ep in the background, s.ctl and s.mu must be held. When the
+// episode finishes it's saved and, if it came from the queue, the queue moves
+// on.
+func (s *server) start(f *pod.Feed, ep *pod.Episode, fromQueue bool) error {
+	p, err := player.New(viper.GetString("player"))
+	if err != nil {
+		return err
+	}
+	if err := p.Start(ep.Source(), ep.Elapsed, s.speed); err != nil {
+		return err
+	}
+
+	// Fetch chapters without holding up other requests and save them under
+	// the lock
+	fetchChapters(ep, func(record func()) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		record()
+		if err := store.SaveEpisode(f, ep); err != nil {
+			log.Println(err)
+		}
+	})
+
+	stop, done := make(chan os.Signal, 1), make(chan bool)
+	s.p, s.stop, s.done, s.feed, s.ep, s.fromQueue = p, stop, done, f, ep, fromQueue
+
+	go func() {
+		st, err := listen(p, stop, func(st player.Status) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			applyStatus(ep, st)
+		})
+
+		next := s.finished(p, f, ep, fromQueue, st, err)
+		close(done)
+		if next {
+			s.playNext()
+		}
+	}()
+
+	return nil
+}
+
+// finished saves ep once p has exited and reports whether the queue should
+// move on
+func (s *server) finished(p player.Player, f *pod.Feed, ep *pod.Episode, fromQueue bool, st player.Status, err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Leave anything that's been started since alone
+	if s.p == p {
+		s.p, s.stop, s.done, s.feed, s.ep = nil, nil, nil, nil, nil
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+	played := applyStatus(ep, st)
+	if err := store.SaveEpisode(f, ep); err != nil {
+		log.Println(err)
+	}
+
+	if !played || !fromQueue {
+		return false
+	}
+
+	it := pod.NewQueueItem(f, ep)
+	if err := store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Remove(it) }); err != nil {
+		log.Println(err)
+		return false
+	}
+
+	return true
+}
+
+// playNext plays the next episode in the queue, unless something else has
+// been started meanwhile
+func (s *server) playNext() {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p != nil {
+		return
+	}
+	if f, ep := s.nextQueued(); ep != nil {
+		if err := s.start(f, ep, true); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// stopPlaying stops the episode that's playing and waits for it to be saved,
+// s.ctl must be held
+func (s *server) stopPlaying() {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	select {
+	case stop <- syscall.SIGINT:
+	default:
+	}
+	<-done
+}
+
+func (s *server) pause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.p == nil {
+			apiError(w, http.StatusConflict, fmt.Errorf("nothing is playing"))
+			return
+		}
+		if err := s.p.Pause(paused); err != nil {
+			apiError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, s.status())
+	}
+}
+
+func (s *server) stopPlayer(w http.ResponseWriter, r *http.Request) {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	s.stopPlaying()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+func (s *server) seek(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Position float64 `json:"position"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p == nil {
+		apiError(w, http.StatusConflict, fmt.Errorf("nothing is playing"))
+		return
+	}
+	if err := s.p.Seek(body.Position); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// chapter skips to the start of a chapter of the episode that's playing
+func (s *server) chapter(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Chapter int `json:"chapter"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p == nil {
+		apiError(w, http.StatusConflict, fmt.Errorf("nothing is playing"))
+		return
+	}
+	if body.Chapter < 0 || body.Chapter >= len(s.ep.Chapters) {
+		apiError(w, http.StatusBadRequest, fmt.Errorf("%s has %d chapters", s.ep.Title, len(s.ep.Chapters)))
+		return
+	}
+	if err := s.p.Seek(s.ep.Chapters[body.Chapter].Start); err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// setSpeed changes the speed of the episode that's playing and any that are
+// played after it
+func (s *server) setSpeed(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Speed float64 `json:"speed"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Speed < 0.01 || body.Speed > 100 {
+		apiError(w, http.StatusBadRequest, fmt.Errorf("speed must be from 0.01 to 100"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p != nil {
+		if err := s.p.SetSpeed(body.Speed); err != nil {
+			apiError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	s.speed = body.Speed
+
+	writeJSON(w, http.StatusOK, s.status())
+}
@@ -0,0 +1,184 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nboughton/yapa/pod"
+	"github.com/spf13/cobra"
+)
+
+// smartCmd represents the smart command
+var smartCmd = &cobra.Command{
+	Use:   "smart",
+	Short: "Manage smart playlists",
+	Long: `Smart playlists are saved queries rather than lists of episodes. They're
+re-evaluated every time they're used with list -l or play -l, so episodes that
+match after an update are picked up automatically. A static playlist in the
+selected feed takes precedence over a smart playlist with the same name.`,
+}
+
+// smartSaveCmd represents the smart save command
+var smartSaveCmd = &cobra.Command{
+	Use:   "save <name>",
+	Short: "Save a query as a smart playlist",
+	Long: `Every flag is optional, a query with no flags matches every episode. Durations
+are given like 45m or 1h30m, dates as YYYY-MM-DD.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			filter, _   = cmd.Flags().GetString("filter")
+			played, _   = cmd.Flags().GetBool("played")
+			unplayed, _ = cmd.Flags().GetBool("unplayed")
+			after, _    = cmd.Flags().GetString("after")
+			before, _   = cmd.Flags().GetString("before")
+			feeds, _    = cmd.Flags().GetString("feeds")
+			min, _      = cmd.Flags().GetDuration("min")
+			max, _      = cmd.Flags().GetDuration("max")
+			season, _   = cmd.Flags().GetInt("season")
+			types, _    = cmd.Flags().GetStringSlice("type")
+			explicit, _ = cmd.Flags().GetBool("explicit")
+			clean, _    = cmd.Flags().GetBool("clean")
+			q           = &pod.Query{Title: filter, MinDuration: int(min.Seconds()), MaxDuration: int(max.Seconds()), Season: season, Types: types}
+			err         error
+		)
+
+		if played && unplayed {
+			fmt.Println("Please only select played OR unplayed")
+			return
+		}
+		if played || unplayed {
+			q.Played = &played
+		}
+
+		if explicit && clean {
+			fmt.Println("Please only select explicit OR clean")
+			return
+		}
+		if explicit || clean {
+			q.Explicit = &explicit
+		}
+
+		if after != "" {
+			if q.After, err = time.ParseInLocation("2006-01-02", after, time.Local); err != nil {
+				fmt.Printf("invalid date: [%s]\n", after)
+				return
+			}
+		}
+		if before != "" {
+			if q.Before, err = time.ParseInLocation("2006-01-02", before, time.Local); err != nil {
+				fmt.Printf("invalid date: [%s]\n", before)
+				return
+			}
+		}
+
+		if feeds != "" {
+			for _, s := range strings.Split(feeds, ",") {
+				id, err := store.FindFeed(s)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				q.Feeds = append(q.Feeds, store.Feeds[id].RSS)
+			}
+		}
+
+		if err := q.Validate(); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if err := store.SaveSmartPlaylist(args[0], q); err != nil {
+			log.Fatal(err)
+		}
+
+		matches, _ := q.Run(store.Feeds) // Validated above
+		fmt.Printf("Smart playlist saved as '%s', %d episodes match\n", args[0], len(matches))
+	},
+}
+
+// smartListCmd represents the smart list command
+var smartListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List smart playlists",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(store.Smart) == 0 {
+			fmt.Println("No smart playlists saved.")
+			return
+		}
+
+		fmt.Fprint(tw, "Name\tEps\tQuery\n")
+		for name, q := range store.Smart {
+			matches, err := q.Run(store.Feeds)
+			if err != nil {
+				fmt.Fprintf(tw, "%s\t-\t%s\n", name, err)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", name, len(matches), q)
+		}
+		tw.Flush()
+	},
+}
+
+// smartDeleteCmd represents the smart delete command
+var smartDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a smart playlist",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, ok := store.Smart[args[0]]; !ok {
+			fmt.Println("Smart playlist not found.")
+			return
+		}
+
+		fmt.Printf("Delete smart playlist '%s', ", args[0])
+		if confirm() {
+			if err := store.SaveSmartPlaylist(args[0], nil); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Smart playlist '%s' deleted.\n", args[0])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(smartCmd)
+	smartCmd.AddCommand(smartSaveCmd)
+	smartCmd.AddCommand(smartListCmd)
+	smartCmd.AddCommand(smartDeleteCmd)
+
+	smartSaveCmd.Flags().StringP("filter", "r", "", "Match episode titles with a RE2 compatible regular expression")
+	smartSaveCmd.Flags().BoolP("played", "p", false, "Only match played episodes")
+	smartSaveCmd.Flags().BoolP("unplayed", "u", false, "Only match unplayed episodes")
+	smartSaveCmd.Flags().String("after", "", "Only match episodes published on or after this date")
+	smartSaveCmd.Flags().String("before", "", "Only match episodes published before this date")
+	smartSaveCmd.Flags().StringP("feeds", "f", "", "Only match episodes from these feeds, a comma separated set of IDs or slugs (0,3,my-podcast)")
+	smartSaveCmd.Flags().Duration("min", 0, "Only match episodes at least this long")
+	smartSaveCmd.Flags().Duration("max", 0, "Only match episodes at most this long")
+	smartSaveCmd.Flags().Int("season", 0, "Only match episodes from this season")
+	smartSaveCmd.Flags().StringSlice("type", nil, "Only match these episode types, full, trailer or bonus (full,bonus)")
+	smartSaveCmd.Flags().Bool("explicit", false, "Only match episodes rated explicit")
+	smartSaveCmd.Flags().Bool("clean", false, "Only match episodes not rated explicit")
+}
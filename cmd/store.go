@@ -0,0 +1,114 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// storeCmd represents the store command
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Manage the store",
+	Long:  `Every write to the store keeps a backup of the previous version. The number kept is set with the backups config key.`,
+}
+
+// storeRestoreCmd represents the store restore command
+var storeRestoreCmd = &cobra.Command{
+	Use:   "restore [backup]",
+	Short: "Roll the store back to a backup",
+	Long: `Without arguments restore lists the available backups, newest first. Pass the
+ID of a backup (or a path to one) to restore it. The current store is backed up
+before it is replaced.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		backups, err := store.Backups()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(args) == 0 {
+			if len(backups) == 0 {
+				fmt.Println("No backups found.")
+				return
+			}
+
+			fmt.Fprint(tw, "ID\tBackup\tSize\n")
+			for i, b := range backups {
+				var size int64
+				if fi, err := os.Stat(b); err == nil {
+					size = fi.Size()
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%d\n", i, filepath.Base(b), size)
+			}
+			tw.Flush()
+			return
+		}
+
+		path := args[0]
+		if id, err := strconv.Atoi(args[0]); err == nil {
+			if id < 0 || id >= len(backups) {
+				fmt.Printf("no backup with id %d\n", id)
+				return
+			}
+			path = backups[id]
+		}
+
+		fmt.Printf("Restore store from '%s', ", filepath.Base(path))
+		if confirm() {
+			if err := store.Restore(path); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println("Store restored.")
+		}
+	},
+}
+
+// storeMigrateCmd represents the store migrate command
+var storeMigrateCmd = &cobra.Command{
+	Use:   "migrate <path>",
+	Short: "Copy the store to a new path, converting between backends",
+	Long: `migrate copies every feed in the current store to a new store at the given
+path. Paths ending in .db, .sqlite or .sqlite3 create an SQLite store, anything
+else a JSON store. Point the store config key at the new path once you're happy
+with it, the current store is left untouched.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := store.Migrate(args[0], viper.GetInt("backups")); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Copied %d feeds to %s. Update the store key in your config to use it.\n", len(store.Feeds), args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(storeCmd)
+	storeCmd.AddCommand(storeRestoreCmd)
+	storeCmd.AddCommand(storeMigrateCmd)
+}
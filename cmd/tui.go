@@ -0,0 +1,625 @@
+// Copyright © 2021 Nick Boughton <nicholasboughton@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/nboughton/yapa/player"
+	"github.com/nboughton/yapa/pod"
+	"github.com/rivo/tview"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// tuiCmd represents the tui command
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse and play feeds in a full screen interface",
+	Long: `Keys:
+
+  tab         switch between the feed and episode panes
+  enter       play the selected episode (or the feed's next unplayed episode)
+  space       pause/resume
+  [ / ]       skip to the previous/next chapter
+  s           stop playing
+  a           add the selected episode to the queue
+  Q           play the queue
+  p / u       mark the selected episode played/unplayed
+  r / R       refresh the selected feed/every feed
+  /           search episode titles (RE2), esc clears the search
+  q           quit`,
+	Run: func(cmd *cobra.Command, args []string) {
+		speed, _ := cmd.Flags().GetFloat32("speed")
+
+		t := newTUI(float64(speed))
+		if err := t.app.Run(); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+
+	tuiCmd.Flags().Float32P("speed", "s", 1.0, "Play speed. Accepts values from 0.01 to 100")
+}
+
+// tui is the state of the full screen interface. Store data is only read and
+// written from tview's event loop, background work hands its results back with
+// QueueUpdateDraw.
+type tui struct {
+	app      *tview.Application
+	feeds    *tview.Table
+	episodes *tview.Table
+	playing  *tview.TextView
+	status   *tview.TextView
+	search   *tview.InputField
+	footer   *tview.Pages
+
+	speed  float64
+	filter *regexp.Regexp
+	shown  pod.Episodes // Episodes in the episode pane, in order
+
+	// Playback state, p is nil when nothing is playing
+	p         player.Player
+	stop      chan os.Signal
+	feed      *pod.Feed
+	ep        *pod.Episode
+	fromQueue bool
+
+	next     func()   // Run once the current episode has stopped
+	deferred []func() // Run once a refresh has finished
+
+	refreshing bool
+	quitting   bool
+}
+
+func newTUI(speed float64) *tui {
+	t := &tui{
+		app:      tview.NewApplication(),
+		feeds:    tview.NewTable().SetSelectable(true, false).SetFixed(1, 0),
+		episodes: tview.NewTable().SetSelectable(true, false).SetFixed(1, 0),
+		playing:  tview.NewTextView().SetDynamicColors(true),
+		status:   tview.NewTextView().SetDynamicColors(true),
+		search:   tview.NewInputField().SetLabel("/"),
+		footer:   tview.NewPages(),
+		speed:    speed,
+	}
+
+	t.feeds.SetBorder(true).SetTitle(" Feeds ")
+	t.episodes.SetBorder(true).SetTitle(" Episodes ")
+	t.playing.SetBorder(true).SetTitle(" Now playing ")
+
+	t.feeds.SetSelectionChangedFunc(func(row, col int) {
+		if !t.refreshing {
+			t.filter = nil
+			t.drawEpisodes()
+		}
+	})
+	t.feeds.SetSelectedFunc(func(row, col int) {
+		t.app.SetFocus(t.episodes)
+	})
+	t.episodes.SetSelectedFunc(func(row, col int) {
+		if ep := t.selectedEpisode(); ep != nil {
+			t.play(t.selectedFeed(), ep, false)
+		}
+	})
+
+	t.search.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			t.setFilter(t.search.GetText())
+		} else {
+			t.search.SetText("")
+			t.setFilter("")
+		}
+		t.footer.SwitchToPage("status")
+		t.app.SetFocus(t.episodes)
+	})
+
+	t.footer.AddPage("status", t.status, true, true)
+	t.footer.AddPage("search", t.search, true, false)
+
+	panes := tview.NewFlex().
+		AddItem(t.feeds, 0, 1, true).
+		AddItem(t.episodes, 0, 2, false)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(panes, 0, 1, true).
+		AddItem(t.playing, 3, 0, false).
+		AddItem(t.footer, 1, 0, false)
+
+	t.app.SetRoot(layout, true).SetInputCapture(t.keys)
+
+	t.drawFeeds()
+	t.drawEpisodes()
+	t.drawPlaying(player.Status{})
+	t.setStatus("")
+
+	return t
+}
+
+// keys handles global key presses. Keys are passed through untouched while
+// searching.
+func (t *tui) keys(ev *tcell.EventKey) *tcell.EventKey {
+	if t.app.GetFocus() == t.search {
+		return ev
+	}
+
+	switch ev.Key() {
+	case tcell.KeyCtrlC:
+		t.quit()
+		return nil
+	case tcell.KeyTab:
+		if t.app.GetFocus() == t.feeds {
+			t.app.SetFocus(t.episodes)
+		} else {
+			t.app.SetFocus(t.feeds)
+		}
+		return nil
+	case tcell.KeyEnter:
+		// Enter on a feed plays its next unplayed episode
+		if t.app.GetFocus() == t.feeds && !t.refreshing {
+			if f := t.selectedFeed(); f != nil {
+				for _, ep := range f.Ordered() {
+					if !ep.Played && !f.Skipped(ep) {
+						t.play(f, ep, false)
+						break
+					}
+				}
+			}
+			return nil
+		}
+		if t.refreshing {
+			return nil
+		}
+		return ev
+	case tcell.KeyRune:
+	default:
+		return ev
+	}
+
+	// Controlling the player doesn't touch the store
+	switch ev.Rune() {
+	case ' ':
+		if t.p != nil {
+			t.p.Pause(!t.p.Status().Paused)
+		}
+		return nil
+	case '[', ']':
+		if t.p != nil {
+			delta := 1
+			if ev.Rune() == '[' {
+				delta = -1
+			}
+			if err := seekChapter(t.p, t.ep.Chapters, delta); err != nil {
+				t.showError(err)
+			}
+		}
+		return nil
+	}
+
+	// Everything below reads or changes the store
+	if t.refreshing && ev.Rune() != 'q' && ev.Rune() != 's' {
+		t.setStatus("[yellow]Refreshing, please wait")
+		return nil
+	}
+
+	switch ev.Rune() {
+	case 'q':
+		t.quit()
+	case 's':
+		t.stopPlaying()
+	case 'a':
+		t.enqueue()
+	case 'Q':
+		t.playQueue()
+	case 'p', 'u':
+		t.mark(ev.Rune() == 'p')
+	case 'r':
+		if f := t.selectedFeed(); f != nil {
+			t.refresh(pod.Feeds{f})
+		}
+	case 'R':
+		t.refresh(store.Feeds)
+	case '/':
+		t.footer.SwitchToPage("search")
+		t.app.SetFocus(t.search)
+	default:
+		return ev
+	}
+
+	return nil
+}
+
+func (t *tui) selectedFeed() *pod.Feed {
+	row, _ := t.feeds.GetSelection()
+	if row < 1 || row > len(store.Feeds) {
+		return nil
+	}
+
+	return store.Feeds[row-1]
+}
+
+func (t *tui) selectedEpisode() *pod.Episode {
+	row, _ := t.episodes.GetSelection()
+	if row < 1 || row > len(t.shown) {
+		return nil
+	}
+
+	return t.shown[row-1]
+}
+
+// drawFeeds fills the feed pane, keeping the selected feed selected
+func (t *tui) drawFeeds() {
+	selected := t.selectedFeed()
+
+	t.feeds.Clear()
+	t.feeds.SetCell(0, 0, tview.NewTableCell("Name").SetSelectable(false).SetExpansion(1))
+	t.feeds.SetCell(0, 1, tview.NewTableCell("Played").SetSelectable(false))
+
+	row := 1
+	for i, f := range store.Feeds {
+		t.feeds.SetCell(i+1, 0, tview.NewTableCell(f.DisplayTitle()).SetExpansion(1))
+		t.feeds.SetCell(i+1, 1, tview.NewTableCell(fmt.Sprintf("%d/%d", f.Played(), len(f.Episodes))).SetAlign(tview.AlignRight))
+		if f == selected {
+			row = i + 1
+		}
+	}
+
+	t.feeds.Select(row, 0)
+}
+
+// drawEpisodes fills the episode pane with the episodes of the selected feed
+// that match the search, keeping the selected episode selected
+func (t *tui) drawEpisodes() {
+	selected := t.selectedEpisode()
+
+	t.episodes.Clear()
+	for i, h := range []string{"", "ID", "Name", "Pub Date", "Length"} {
+		t.episodes.SetCell(0, i, tview.NewTableCell(h).SetSelectable(false))
+	}
+	t.episodes.GetCell(0, 2).SetExpansion(1)
+
+	t.shown = pod.Episodes{}
+	f := t.selectedFeed()
+	if f == nil {
+		return
+	}
+
+	title := fmt.Sprintf(" %s ", f.DisplayTitle())
+	if t.filter != nil {
+		title = fmt.Sprintf(" %s [/%s] ", f.DisplayTitle(), t.search.GetText())
+	}
+	t.episodes.SetTitle(title)
+
+	row := 1
+	for _, ep := range f.Ordered() {
+		if t.filter != nil && !t.filter.MatchString(ep.Title) {
+			continue
+		}
+		t.shown = append(t.shown, ep)
+
+		n := len(t.shown)
+		t.episodes.SetCell(n, 0, tview.NewTableCell(t.marker(ep)))
+		t.episodes.SetCell(n, 1, tview.NewTableCell(fmt.Sprint(ep.ID)).SetAlign(tview.AlignRight))
+		t.episodes.SetCell(n, 2, tview.NewTableCell(episodeTitle(ep)).SetExpansion(1))
+		t.episodes.SetCell(n, 3, tview.NewTableCell(ep.Published.Format(dateFmt)))
+		t.episodes.SetCell(n, 4, tview.NewTableCell(tuiLength(ep)).SetAlign(tview.AlignRight))
+		if ep == selected {
+			row = n
+		}
+	}
+
+	t.episodes.Select(row, 0)
+}
+
+// marker shows the state of an episode: playing, played, in progress and/or
+// downloaded
+func (t *tui) marker(ep *pod.Episode) string {
+	m := " "
+	switch {
+	case ep == t.ep:
+		m = "[green]▶[-]"
+	case ep.Played:
+		m = "✓"
+	case ep.Elapsed > 0:
+		m = "[yellow]…[-]"
+	}
+
+	if ep.File != "" {
+		m += "↓"
+	}
+
+	return m
+}
+
+// tuiLength shows how much of an episode is left if it's in progress
+func tuiLength(ep *pod.Episode) string {
+	switch {
+	case ep.Elapsed > 0 && ep.Duration > 0:
+		return pod.ParseElapsed(ep.Elapsed) + " / " + pod.ParseElapsed(ep.Duration)
+	case ep.Elapsed > 0:
+		return pod.ParseElapsed(ep.Elapsed)
+	case ep.Duration > 0:
+		return pod.ParseElapsed(ep.Duration)
+	}
+
+	return ""
+}
+
+func (t *tui) drawPlaying(st player.Status) {
+	if t.ep == nil {
+		t.playing.SetText("Nothing playing")
+		return
+	}
+
+	status := playStatus(st)
+	if ch := chapterStatus(t.ep.Chapters, st.Position); ch != "" {
+		status += " | " + ch
+	}
+
+	t.playing.SetText(fmt.Sprintf("[::b]%s[::-] - %s\n%s",
+		tview.Escape(t.feed.DisplayTitle()), tview.Escape(t.ep.Title), tview.Escape(status)))
+}
+
+func (t *tui) setStatus(msg string) {
+	if msg == "" {
+		msg = fmt.Sprintf("%d queued | enter play  space pause  [/] chapter  s stop  a queue  Q play queue  p/u mark  r/R refresh  / search  q quit", len(store.Queue))
+	}
+
+	t.status.SetText(msg)
+}
+
+func (t *tui) showError(err error) {
+	t.setStatus("[red]" + tview.Escape(err.Error()))
+}
+
+func (t *tui) setFilter(s string) {
+	t.filter = nil
+	if s != "" {
+		r, err := regexp.Compile("(?i)" + s)
+		if err != nil {
+			t.showError(err)
+			return
+		}
+		t.filter = r
+	}
+
+	t.drawEpisodes()
+}
+
+// play stops anything that's playing and starts ep. The player runs in the
+// background and the now playing bar is updated once a second.
+func (t *tui) play(f *pod.Feed, ep *pod.Episode, fromQueue bool) {
+	if t.p != nil {
+		// Start ep once the current episode has been saved
+		t.next = func() { t.play(f, ep, fromQueue) }
+		t.stopPlaying()
+		return
+	}
+
+	p, err := player.New(viper.GetString("player"))
+	if err != nil {
+		t.showError(err)
+		return
+	}
+
+	if err := p.Start(ep.Source(), ep.Elapsed, t.speed); err != nil {
+		t.showError(err)
+		return
+	}
+
+	stop := make(chan os.Signal, 1)
+	t.p, t.stop, t.feed, t.ep, t.fromQueue = p, stop, f, ep, fromQueue
+	t.drawEpisodes()
+	t.drawPlaying(player.Status{Position: float64(ep.Elapsed)})
+
+	if showNotify {
+		go sendNotify(f.DisplayTitle(), ep.Title)
+	}
+
+	// Fetch chapters in the background and save them from the event loop
+	fetchChapters(ep, func(record func()) {
+		t.app.QueueUpdateDraw(func() {
+			record()
+			if !t.refreshing {
+				store.SaveEpisode(f, ep)
+			}
+		})
+	})
+
+	go func() {
+		st, err := listen(p, stop, func(st player.Status) {
+			t.app.QueueUpdateDraw(func() {
+				applyStatus(ep, st)
+				t.drawPlaying(st)
+			})
+		})
+		t.app.QueueUpdateDraw(func() { t.done(applyStatus(ep, st), err) })
+	}()
+}
+
+// done saves the state of the episode that was playing and moves on to the
+// next in the queue if it was played from the queue
+func (t *tui) done(finished bool, err error) {
+	if t.refreshing {
+		// The feed may be being rewritten, save it once the refresh is done
+		t.deferred = append(t.deferred, func() { t.done(finished, err) })
+		return
+	}
+
+	f, ep, fromQueue, next := t.feed, t.ep, t.fromQueue, t.next
+	t.p, t.stop, t.feed, t.ep, t.next = nil, nil, nil, nil, nil
+
+	if serr := store.SaveEpisode(f, ep); serr != nil && err == nil {
+		err = serr
+	}
+
+	if err == nil && finished && fromQueue {
+		err = store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Remove(pod.NewQueueItem(f, ep)) })
+	}
+
+	t.drawFeeds()
+	t.drawEpisodes()
+	t.drawPlaying(player.Status{})
+	if err != nil {
+		t.showError(err)
+	} else {
+		t.setStatus("")
+	}
+
+	switch {
+	case t.quitting:
+		t.app.Stop()
+	case next != nil:
+		next()
+	case err == nil && finished && fromQueue:
+		t.playQueue()
+	}
+}
+
+func (t *tui) stopPlaying() {
+	if t.p == nil {
+		return
+	}
+
+	select {
+	case t.stop <- syscall.SIGINT:
+	default:
+	}
+}
+
+func (t *tui) quit() {
+	if t.p == nil {
+		t.app.Stop()
+		return
+	}
+
+	// Stop once the position has been saved
+	t.quitting = true
+	t.stopPlaying()
+}
+
+func (t *tui) enqueue() {
+	f, ep := t.selectedFeed(), t.selectedEpisode()
+	if ep == nil {
+		return
+	}
+
+	if err := store.UpdateQueue(func(q pod.Queue) pod.Queue { return q.Add(pod.NewQueueItem(f, ep)) }); err != nil {
+		t.showError(err)
+		return
+	}
+
+	t.setStatus(fmt.Sprintf("Queued %s, %d in the queue", tview.Escape(ep.Title), len(store.Queue)))
+}
+
+// playQueue plays the first episode in the queue that's still in the store
+func (t *tui) playQueue() {
+	for _, it := range store.Queue {
+		if f, ep := store.Queued(it); ep != nil {
+			t.play(f, ep, true)
+			return
+		}
+	}
+
+	t.setStatus("The queue is empty")
+}
+
+func (t *tui) mark(played bool) {
+	f, ep := t.selectedFeed(), t.selectedEpisode()
+	if ep == nil || ep == t.ep {
+		return
+	}
+
+	ep.MarkPlayed(played)
+	if err := store.SaveFeed(f); err != nil {
+		t.showError(err)
+		return
+	}
+
+	t.drawFeeds()
+	t.drawEpisodes()
+}
+
+// refresh updates feeds in the background. Store data isn't touched by the
+// event loop until the update is finished.
+func (t *tui) refresh(feeds pod.Feeds) {
+	t.refreshing = true
+	t.setStatus(fmt.Sprintf("Refreshing %d feeds...", len(feeds)))
+
+	go func() {
+		var (
+			timeout = time.Duration(viper.GetInt("update_timeout")) * time.Second
+			added   int
+			failed  int
+		)
+
+		if len(feeds) == len(store.Feeds) {
+			for _, r := range store.Update(pod.UpdateOptions{
+				Workers: viper.GetInt("update_workers"),
+				PerHost: viper.GetInt("update_host_limit"),
+				Timeout: timeout,
+			}) {
+				added += r.NewEpisodes
+				if r.Err != nil && !errors.Is(r.Err, pod.ErrNotModified) && !errors.Is(r.Err, pod.ErrCached) {
+					failed++
+				}
+			}
+		} else {
+			for _, f := range feeds {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				n, err := f.Update(ctx, false)
+				cancel()
+
+				added += n
+				if err != nil && !errors.Is(err, pod.ErrNotModified) && !errors.Is(err, pod.ErrCached) {
+					failed++
+				}
+			}
+		}
+
+		t.app.QueueUpdateDraw(func() {
+			t.refreshing = false
+
+			if err := store.SaveFeed(feeds...); err != nil {
+				t.showError(err)
+			} else {
+				t.drawFeeds()
+				t.drawEpisodes()
+				t.setStatus(fmt.Sprintf("%d new episodes, %d feeds failed to refresh", added, failed))
+			}
+
+			for _, fn := range t.deferred {
+				fn()
+			}
+			t.deferred = nil
+		})
+	}()
+}
@@ -21,25 +21,129 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/nboughton/yapa/pod"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // updateCmd represents the update command
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update the store",
-	//Long: ``,
+	Long: `Feeds are refreshed concurrently. The number of workers, the number of
+simultaneous requests to any one host and the per-feed timeout can be set with
+the update_workers, update_host_limit and update_timeout (seconds) config keys.
+
+Requests are conditional (ETag/Last-Modified) and Cache-Control and Retry-After
+headers are honoured, so feeds that haven't changed are not downloaded again.
+Use --force to ignore HTTP caching.
+
+Once feeds are refreshed each feed's download policy (see yapa feed policy) is
+applied and, if the quota config key is set (in MB), played episodes are
+deleted, oldest first, until the library fits.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := store.Update(); err != nil {
+		var (
+			force, _      = cmd.Flags().GetBool("force")
+			noDownload, _ = cmd.Flags().GetBool("no-download")
+		)
+
+		results := store.Update(pod.UpdateOptions{
+			Workers: viper.GetInt("update_workers"),
+			PerHost: viper.GetInt("update_host_limit"),
+			Timeout: time.Duration(viper.GetInt("update_timeout")) * time.Second,
+			Force:   force,
+		})
+		if err := pod.WriteStore(store); err != nil {
+			log.Fatal(err)
+		}
+
+		var (
+			updated, unchanged, added int
+			failed                    []pod.UpdateResult
+		)
+
+		fmt.Fprint(tw, "Feed\tNew\tTime\tStatus\n")
+		for _, r := range results {
+			status := "OK"
+			switch {
+			case errors.Is(r.Err, pod.ErrNotModified):
+				status = "Not modified"
+				unchanged++
+			case errors.Is(r.Err, pod.ErrCached):
+				status = "Cached until " + r.Feed.NextCheck.Format(dateFmt)
+				unchanged++
+			case r.Err != nil:
+				status = "Failed"
+				failed = append(failed, r)
+			default:
+				updated++
+				added += r.NewEpisodes
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", r.Feed.DisplayTitle(), r.NewEpisodes, r.Duration.Round(time.Millisecond), status)
+		}
+		tw.Flush()
+
+		fmt.Printf("\nUpdated %d/%d feeds (%d unchanged), %d new episodes\n", updated, len(results), unchanged, added)
+		if len(failed) > 0 {
+			fmt.Println("\nFailures:")
+			for _, r := range failed {
+				fmt.Fprintf(tw, "%s\t%s\n", r.Feed.DisplayTitle(), r.Err)
+			}
+			tw.Flush()
+		}
+
+		if noDownload {
+			return
+		}
+
+		report := store.ApplyPolicies(context.Background(), viper.GetString("library"), viper.GetInt64("quota")*1024*1024, viper.GetInt("download_workers"))
+		if err := pod.WriteStore(store); err != nil {
 			log.Fatal(err)
 		}
-		pod.WriteStore(store)
+
+		if len(report.Downloads) == 0 && len(report.Deleted) == 0 && len(report.Errors) == 0 {
+			return
+		}
+
+		fmt.Println("\nLibrary:")
+		for _, d := range report.Downloads {
+			status := "Downloaded"
+			switch {
+			case d.Err != nil:
+				status = fmt.Sprintf("Download failed: %s", d.Err)
+			case d.Warning != "":
+				status = fmt.Sprintf("Downloaded, %s", d.Warning)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Feed.DisplayTitle(), d.Episode.Title, status)
+		}
+		for _, ep := range report.Deleted {
+			fmt.Fprintf(tw, "\t%s\tDeleted\n", ep.Title)
+		}
+		for _, err := range report.Errors {
+			fmt.Fprintf(tw, "\t\t%s\n", err)
+		}
+		tw.Flush()
+		fmt.Printf("\nLibrary size: %s\n", byteSize(report.Size))
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(updateCmd)
+
+	updateCmd.Flags().IntP("workers", "w", pod.DefaultWorkers, "Number of feeds to refresh at once")
+	updateCmd.Flags().Int("host-limit", pod.DefaultPerHost, "Number of simultaneous requests allowed to a single host")
+	updateCmd.Flags().Int("timeout", int(pod.DefaultTimeout/time.Second), "Seconds allowed to refresh each feed")
+
+	updateCmd.Flags().BoolP("force", "F", false, "Ignore HTTP caching and fetch every feed in full")
+	updateCmd.Flags().BoolP("no-download", "n", false, "Don't apply download policies")
+
+	viper.BindPFlag("update_workers", updateCmd.Flags().Lookup("workers"))
+	viper.BindPFlag("update_host_limit", updateCmd.Flags().Lookup("host-limit"))
+	viper.BindPFlag("update_timeout", updateCmd.Flags().Lookup("timeout"))
 }
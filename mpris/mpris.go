@@ -0,0 +1,340 @@
+// Package mpris publishes the episode yapa is playing on the D-Bus session
+// bus using the MPRIS specification, so media keys, desktop widgets and tools
+// like playerctl can see and control it.
+package mpris
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/nboughton/yapa/player"
+)
+
+// Bus names, object path and interfaces from the MPRIS specification
+const (
+	busName     = "org.mpris.MediaPlayer2.yapa"
+	path        = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	ifaceRoot   = "org.mpris.MediaPlayer2"
+	ifacePlayer = "org.mpris.MediaPlayer2.Player"
+)
+
+// Metadata describes the episode that's playing
+type Metadata struct {
+	ID      string // Anything that uniquely identifies the episode
+	Feed    string
+	Title   string
+	Artwork string  // Image URL
+	URL     string  // Location of the audio
+	Length  float64 // Seconds, 0 if unknown
+}
+
+// Handlers are called when a client asks to skip to the next or previous
+// episode. Either can be nil if there's nowhere to skip to.
+type Handlers struct {
+	Next     func()
+	Previous func()
+}
+
+// Server publishes a player on the session bus
+type Server struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+	p     player.Player
+	h     Handlers
+	md    Metadata
+	track dbus.ObjectPath
+
+	mu   sync.Mutex
+	last player.Status // Last status published, to only signal changes
+}
+
+// Start publishing p, which must already be playing, on the session bus
+func Start(p player.Player, md Metadata, h Handlers) (*Server, error) {
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err = conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &Server{
+		conn:  conn,
+		p:     p,
+		h:     h,
+		md:    md,
+		track: dbus.ObjectPath(fmt.Sprintf("/org/yapa/episode/%x", sha1.Sum([]byte(md.ID)))),
+	}
+
+	if err := s.export(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Another yapa may already be playing, the specification allows for
+	// instances to be told apart by a suffix
+	reply, err := conn.RequestName(busName, dbus.NameFlagDoNotQueue)
+	if err == nil && reply != dbus.RequestNameReplyPrimaryOwner {
+		reply, err = conn.RequestName(fmt.Sprintf("%s.instance%d", busName, os.Getpid()), dbus.NameFlagDoNotQueue)
+	}
+	if err == nil && reply != dbus.RequestNameReplyPrimaryOwner {
+		err = fmt.Errorf("could not claim an MPRIS bus name")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// export the MPRIS interfaces and their properties
+func (s *Server) export() error {
+	st := s.p.Status()
+	s.last = st
+
+	props, err := prop.Export(s.conn, path, map[string]map[string]*prop.Prop{
+		ifaceRoot: {
+			"CanQuit":             {Value: true, Emit: prop.EmitConst},
+			"CanRaise":            {Value: false, Emit: prop.EmitConst},
+			"HasTrackList":        {Value: false, Emit: prop.EmitConst},
+			"Identity":            {Value: "yapa", Emit: prop.EmitConst},
+			"SupportedUriSchemes": {Value: []string{}, Emit: prop.EmitConst},
+			"SupportedMimeTypes":  {Value: []string{}, Emit: prop.EmitConst},
+		},
+		ifacePlayer: {
+			"PlaybackStatus": {Value: playbackStatus(st), Emit: prop.EmitTrue},
+			"Rate":           {Value: st.Speed, Emit: prop.EmitTrue},
+			"Metadata":       {Value: s.metadata(st), Emit: prop.EmitTrue},
+			"Position":       {Value: microseconds(st.Position), Emit: prop.EmitFalse},
+			"MinimumRate":    {Value: 0.01, Emit: prop.EmitConst},
+			"MaximumRate":    {Value: 100.0, Emit: prop.EmitConst},
+			"CanGoNext":      {Value: s.h.Next != nil, Emit: prop.EmitConst},
+			"CanGoPrevious":  {Value: s.h.Previous != nil, Emit: prop.EmitConst},
+			"CanPlay":        {Value: true, Emit: prop.EmitConst},
+			"CanPause":       {Value: true, Emit: prop.EmitConst},
+			"CanSeek":        {Value: true, Emit: prop.EmitConst},
+			"CanControl":     {Value: true, Emit: prop.EmitConst},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.props = props
+
+	if err := s.conn.Export(root{s}, path, ifaceRoot); err != nil {
+		return err
+	}
+	if err := s.conn.ExportWithMap(playerObj{s}, map[string]string{"SeekBy": "Seek"}, path, ifacePlayer); err != nil {
+		return err
+	}
+
+	methods := introspect.Methods(playerObj{s})
+	for i := range methods {
+		if methods[i].Name == "SeekBy" {
+			methods[i].Name = "Seek"
+		}
+	}
+
+	node := &introspect.Node{
+		Name: string(path),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{Name: ifaceRoot, Methods: introspect.Methods(root{s}), Properties: props.Introspection(ifaceRoot)},
+			{
+				Name:       ifacePlayer,
+				Methods:    methods,
+				Properties: props.Introspection(ifacePlayer),
+				Signals:    []introspect.Signal{{Name: "Seeked", Args: []introspect.Arg{{Name: "Position", Type: "x"}}}},
+			},
+		},
+	}
+
+	return s.conn.Export(introspect.NewIntrospectable(node), path, "org.freedesktop.DBus.Introspectable")
+}
+
+// Update publishes the player's status. Call it regularly so that clients
+// see the current position.
+func (s *Server) Update(st player.Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.props.SetMust(ifacePlayer, "Position", microseconds(st.Position))
+
+	if playbackStatus(st) != playbackStatus(s.last) {
+		s.props.SetMust(ifacePlayer, "PlaybackStatus", playbackStatus(st))
+	}
+	if st.Speed != s.last.Speed && st.Speed > 0 {
+		s.props.SetMust(ifacePlayer, "Rate", st.Speed)
+	}
+	if st.Duration != s.last.Duration {
+		s.props.SetMust(ifacePlayer, "Metadata", s.metadata(st))
+	}
+
+	s.last = st
+}
+
+// Close removes the player from the session bus
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// metadata for the episode in MPRIS form. The player's idea of the length is
+// preferred to the feed's as it's more likely to be right.
+func (s *Server) metadata(st player.Status) map[string]dbus.Variant {
+	length := s.md.Length
+	if st.Duration > 0 {
+		length = st.Duration
+	}
+
+	md := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(s.track),
+		"xesam:title":   dbus.MakeVariant(s.md.Title),
+		"xesam:album":   dbus.MakeVariant(s.md.Feed),
+		"xesam:artist":  dbus.MakeVariant([]string{s.md.Feed}),
+	}
+	if length > 0 {
+		md["mpris:length"] = dbus.MakeVariant(microseconds(length))
+	}
+	if s.md.Artwork != "" {
+		md["mpris:artUrl"] = dbus.MakeVariant(s.md.Artwork)
+	}
+	if s.md.URL != "" {
+		md["xesam:url"] = dbus.MakeVariant(s.md.URL)
+	}
+
+	return md
+}
+
+// playerObj implements the org.mpris.MediaPlayer2.Player interface
+type playerObj struct {
+	s *Server
+}
+
+// Next implements org.mpris.MediaPlayer2.Player
+func (o playerObj) Next() *dbus.Error {
+	if o.s.h.Next != nil {
+		o.s.h.Next()
+	}
+	return nil
+}
+
+// Previous implements org.mpris.MediaPlayer2.Player
+func (o playerObj) Previous() *dbus.Error {
+	if o.s.h.Previous != nil {
+		o.s.h.Previous()
+	}
+	return nil
+}
+
+// Pause implements org.mpris.MediaPlayer2.Player
+func (o playerObj) Pause() *dbus.Error {
+	return dbusError(o.s.p.Pause(true))
+}
+
+// Play implements org.mpris.MediaPlayer2.Player
+func (o playerObj) Play() *dbus.Error {
+	return dbusError(o.s.p.Pause(false))
+}
+
+// PlayPause implements org.mpris.MediaPlayer2.Player
+func (o playerObj) PlayPause() *dbus.Error {
+	return dbusError(o.s.p.Pause(!o.s.p.Status().Paused))
+}
+
+// Stop implements org.mpris.MediaPlayer2.Player. yapa saves the position and
+// exits just as it does on ctrl+c.
+func (o playerObj) Stop() *dbus.Error {
+	return dbusError(o.s.p.Stop())
+}
+
+// SeekBy implements Seek from org.mpris.MediaPlayer2.Player, it's renamed to
+// keep clear of io.Seeker. offset is in microseconds.
+func (o playerObj) SeekBy(offset int64) *dbus.Error {
+	st := o.s.p.Status()
+	pos := st.Position + float64(offset)/1e6
+	if pos < 0 {
+		pos = 0
+	}
+
+	// Seeking past the end skips to the next episode
+	if st.Duration > 0 && pos > st.Duration {
+		return o.Next()
+	}
+
+	return o.s.seek(pos)
+}
+
+// SetPosition implements org.mpris.MediaPlayer2.Player. position is in
+// microseconds and is ignored if track isn't the episode that's playing.
+func (o playerObj) SetPosition(track dbus.ObjectPath, position int64) *dbus.Error {
+	st := o.s.p.Status()
+	pos := float64(position) / 1e6
+	if track != o.s.track || pos < 0 || (st.Duration > 0 && pos > st.Duration) {
+		return nil
+	}
+
+	return o.s.seek(pos)
+}
+
+// OpenUri implements org.mpris.MediaPlayer2.Player. yapa only plays episodes
+// from its store.
+func (o playerObj) OpenUri(uri string) *dbus.Error {
+	return dbus.MakeFailedError(fmt.Errorf("yapa can't open URIs"))
+}
+
+// seek to pos seconds and tell clients the position has jumped
+func (s *Server) seek(pos float64) *dbus.Error {
+	if err := s.p.Seek(pos); err != nil {
+		return dbusError(err)
+	}
+
+	s.props.SetMust(ifacePlayer, "Position", microseconds(pos))
+	return dbusError(s.conn.Emit(path, ifacePlayer+".Seeked", microseconds(pos)))
+}
+
+// root implements the org.mpris.MediaPlayer2 interface
+type root struct {
+	s *Server
+}
+
+// Raise implements org.mpris.MediaPlayer2. yapa has no window to raise.
+func (r root) Raise() *dbus.Error {
+	return nil
+}
+
+// Quit implements org.mpris.MediaPlayer2
+func (r root) Quit() *dbus.Error {
+	return playerObj{r.s}.Stop()
+}
+
+func playbackStatus(st player.Status) string {
+	if st.Paused {
+		return "Paused"
+	}
+
+	return "Playing"
+}
+
+func microseconds(seconds float64) int64 {
+	return int64(seconds * 1e6)
+}
+
+func dbusError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+
+	return dbus.MakeFailedError(err)
+}
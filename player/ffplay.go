@@ -0,0 +1,146 @@
+package player
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// FFPlay plays files with ffplay. ffplay can't be queried so the position is
+// worked out from the time spent playing, and pausing suspends the process. The
+// duration is read from the file information ffplay logs when it starts.
+type FFPlay struct {
+	proc
+	offset  float64
+	resumed time.Time     // When playback last started or resumed
+	played  time.Duration // Time spent playing before that
+	read    chan bool     // Closed once all of stderr has been read
+}
+
+// Start implements Player
+func (f *FFPlay) Start(source string, start int, speed float64) error {
+	f.status = Status{Position: float64(start), Speed: speed, Started: true}
+	f.offset = float64(start)
+
+	args := []string{
+		"-nodisp", "-autoexit",
+		"-hide_banner", "-nostats",
+		"-loglevel", "info",
+		"-af", fmt.Sprintf("atempo=%.2f", speed),
+	}
+	if start > 0 {
+		args = append(args, "-ss", strconv.Itoa(start))
+	}
+	args = append(args, source)
+
+	f.prepare("ffplay", args...)
+	stderr, err := f.cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	f.resumed = time.Now()
+	if err := f.cmd.Start(); err != nil {
+		return err
+	}
+
+	f.read = make(chan bool)
+	go f.listen(stderr)
+	return nil
+}
+
+var ffDuration = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+
+// listen reads the duration of the file from ffplay's log
+func (f *FFPlay) listen(r io.Reader) {
+	defer close(f.read)
+
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		if d := parseFFDuration(scan.Text()); d > 0 {
+			f.update(func(st *Status) {
+				if st.Duration == 0 {
+					st.Duration = d
+				}
+			})
+		}
+	}
+}
+
+// parseFFDuration reads the duration from a line of ffmpeg's file information,
+// "Duration: 00:45:12.34, start: ...". It returns 0 for any other line.
+func parseFFDuration(line string) float64 {
+	m := ffDuration.FindStringSubmatch(line)
+	if m == nil {
+		return 0
+	}
+
+	h, _ := strconv.ParseFloat(m[1], 64)
+	mins, _ := strconv.ParseFloat(m[2], 64)
+	sec, _ := strconv.ParseFloat(m[3], 64)
+	return h*3600 + mins*60 + sec
+}
+
+// Status implements Player
+func (f *FFPlay) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	played := f.played
+	if !f.status.Paused {
+		played += time.Since(f.resumed)
+	}
+	f.status.Position = f.offset + played.Seconds()*f.status.Speed
+
+	return f.status
+}
+
+// Pause implements Player
+func (f *FFPlay) Pause(paused bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.status.Paused == paused {
+		return nil
+	}
+
+	if paused {
+		f.played += time.Since(f.resumed)
+		f.status.Paused = true
+		return f.cmd.Process.Signal(syscall.SIGSTOP)
+	}
+
+	f.resumed = time.Now()
+	f.status.Paused = false
+	return f.cmd.Process.Signal(syscall.SIGCONT)
+}
+
+// SetSpeed implements Player
+func (f *FFPlay) SetSpeed(speed float64) error {
+	return fmt.Errorf("ffplay can't change speed during playback")
+}
+
+// Seek implements Player
+func (f *FFPlay) Seek(position float64) error {
+	return fmt.Errorf("ffplay can't seek during playback")
+}
+
+// Stop implements Player
+func (f *FFPlay) Stop() error {
+	if f.Status().Paused {
+		f.Pause(false)
+	}
+
+	return f.terminate()
+}
+
+// Wait implements Player
+func (f *FFPlay) Wait() error {
+	// stderr has to be read before the process is waited for
+	<-f.read
+	return f.wait(false)
+}
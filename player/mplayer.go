@@ -0,0 +1,136 @@
+package player
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MPlayer plays files with mplayer, polling its position in slave mode
+type MPlayer struct {
+	proc
+	stdin io.WriteCloser
+	done  chan struct{}
+	read  chan bool // Closed once all of stdout has been read
+}
+
+// Start implements Player
+func (m *MPlayer) Start(source string, start int, speed float64) error {
+	m.status = Status{Position: float64(start), Speed: speed}
+	m.done, m.read = make(chan struct{}), make(chan bool)
+
+	args := []string{
+		"-slave", "-quiet", "-novideo",
+		"-af", "scaletempo",
+		"-speed", fmt.Sprintf("%.2f", speed),
+	}
+	if start > 0 {
+		args = append(args, "-ss", strconv.Itoa(start))
+	}
+	args = append(args, source)
+
+	m.prepare("mplayer", args...)
+	stdout, err := m.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if m.stdin, err = m.cmd.StdinPipe(); err != nil {
+		return err
+	}
+	if err := m.cmd.Start(); err != nil {
+		return err
+	}
+
+	go m.listen(stdout)
+	go m.poll()
+	return nil
+}
+
+// Pause implements Player
+func (m *MPlayer) Pause(paused bool) error {
+	if m.Status().Paused == paused {
+		return nil
+	}
+
+	m.update(func(st *Status) { st.Paused = paused })
+	return m.send("pause")
+}
+
+// SetSpeed implements Player
+func (m *MPlayer) SetSpeed(speed float64) error {
+	m.update(func(st *Status) { st.Speed = speed })
+	return m.send(fmt.Sprintf("pausing_keep_force speed_set %.2f", speed))
+}
+
+// Seek implements Player
+func (m *MPlayer) Seek(position float64) error {
+	m.update(func(st *Status) { st.Position = position })
+	return m.send(fmt.Sprintf("pausing_keep_force seek %.1f 2", position))
+}
+
+// Stop implements Player
+func (m *MPlayer) Stop() error {
+	m.mu.Lock()
+	m.stopped = true
+	m.mu.Unlock()
+
+	return m.send("quit")
+}
+
+// Wait implements Player
+func (m *MPlayer) Wait() error {
+	// The process can't be waited for until stdout has been read, or the
+	// last lines, like the end of the file, may be lost
+	<-m.read
+	err := m.wait(true)
+	close(m.done)
+	return err
+}
+
+// send a slave mode command
+func (m *MPlayer) send(command string) error {
+	_, err := fmt.Fprintln(m.stdin, command)
+	return err
+}
+
+// poll asks mplayer for its position until it exits
+func (m *MPlayer) poll() {
+	tick := time.NewTicker(time.Second / 2)
+	defer tick.Stop()
+
+	m.send("pausing_keep_force get_time_length")
+	for {
+		select {
+		case <-tick.C:
+			m.send("pausing_keep_force get_time_pos")
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// listen reads answers from mplayer's stdout
+func (m *MPlayer) listen(r io.Reader) {
+	defer close(m.read)
+
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+
+		m.update(func(st *Status) {
+			switch {
+			case strings.HasPrefix(line, "ANS_TIME_POSITION="):
+				if pos, err := strconv.ParseFloat(strings.TrimPrefix(line, "ANS_TIME_POSITION="), 64); err == nil {
+					st.Position, st.Started = pos, true
+				}
+			case strings.HasPrefix(line, "ANS_LENGTH="):
+				st.Duration, _ = strconv.ParseFloat(strings.TrimPrefix(line, "ANS_LENGTH="), 64)
+			case strings.Contains(line, "(End of file)"):
+				st.EOF = true
+			}
+		})
+	}
+}
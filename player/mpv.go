@@ -0,0 +1,177 @@
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MPV plays files with mpv, tracking its state over mpv's JSON IPC socket
+type MPV struct {
+	proc
+	socket string
+	conn   net.Conn
+	read   chan bool // Closed once every event has been read
+}
+
+// mpv property observer ids
+const (
+	obsTimePos = iota + 1
+	obsDuration
+	obsPause
+	obsSpeed
+)
+
+// Start implements Player
+func (m *MPV) Start(source string, start int, speed float64) error {
+	m.socket = filepath.Join(os.TempDir(), fmt.Sprintf("yapa-mpv-%d.sock", os.Getpid()))
+	m.status = Status{Position: float64(start), Speed: speed}
+
+	args := []string{
+		"--no-video",
+		"--input-ipc-server=" + m.socket,
+		fmt.Sprintf("--speed=%.2f", speed),
+	}
+	if start > 0 {
+		args = append(args, fmt.Sprintf("--start=%d", start))
+	}
+	args = append(args, source)
+
+	os.Remove(m.socket)
+	if err := m.start("mpv", args...); err != nil {
+		return err
+	}
+
+	// mpv creates the socket shortly after starting
+	var err error
+	for i := 0; i < 50; i++ {
+		if m.conn, err = net.Dial("unix", m.socket); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		m.cmd.Process.Kill()
+		m.cmd.Wait()
+		return fmt.Errorf("could not connect to mpv: %s", err)
+	}
+
+	for id, prop := range map[int]string{
+		obsTimePos:  "time-pos",
+		obsDuration: "duration",
+		obsPause:    "pause",
+		obsSpeed:    "speed",
+	} {
+		if err := m.command("observe_property", id, prop); err != nil {
+			m.cmd.Process.Kill()
+			m.Wait()
+			return err
+		}
+	}
+
+	m.read = make(chan bool)
+	go m.listen()
+	return nil
+}
+
+// Pause implements Player
+func (m *MPV) Pause(paused bool) error {
+	return m.command("set_property", "pause", paused)
+}
+
+// SetSpeed implements Player
+func (m *MPV) SetSpeed(speed float64) error {
+	return m.command("set_property", "speed", speed)
+}
+
+// Seek implements Player
+func (m *MPV) Seek(position float64) error {
+	return m.command("seek", position, "absolute")
+}
+
+// Stop implements Player
+func (m *MPV) Stop() error {
+	m.mu.Lock()
+	m.stopped = true
+	m.mu.Unlock()
+
+	return m.command("quit")
+}
+
+// Wait implements Player
+func (m *MPV) Wait() error {
+	err := m.wait(true)
+
+	// mpv can exit before its last events, like end-file, have been read
+	if m.read != nil {
+		select {
+		case <-m.read:
+		case <-time.After(time.Second):
+		}
+	}
+	m.conn.Close()
+	os.Remove(m.socket)
+	return err
+}
+
+// command sends a command to mpv
+func (m *MPV) command(args ...interface{}) error {
+	data, err := json.Marshal(map[string]interface{}{"command": args})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.conn.Write(append(data, '\n'))
+	return err
+}
+
+// listen reads events from mpv until the connection closes
+func (m *MPV) listen() {
+	defer close(m.read)
+
+	scan := bufio.NewScanner(m.conn)
+	for scan.Scan() {
+		m.update(func(st *Status) {
+			mpvEvent(st, scan.Bytes())
+		})
+	}
+}
+
+// mpvEvent applies one line of mpv's IPC output to st. Command replies and
+// anything that isn't an event we observe are ignored.
+func mpvEvent(st *Status, line []byte) {
+	var ev struct {
+		Event  string          `json:"event"`
+		ID     int             `json:"id"`
+		Data   json.RawMessage `json:"data"`
+		Reason string          `json:"reason"`
+	}
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return
+	}
+
+	switch ev.Event {
+	case "property-change":
+		switch ev.ID {
+		case obsTimePos:
+			// time-pos is null until playback starts
+			var pos *float64
+			if json.Unmarshal(ev.Data, &pos) == nil && pos != nil {
+				st.Position, st.Started = *pos, true
+			}
+		case obsDuration:
+			json.Unmarshal(ev.Data, &st.Duration)
+		case obsPause:
+			json.Unmarshal(ev.Data, &st.Paused)
+		case obsSpeed:
+			json.Unmarshal(ev.Data, &st.Speed)
+		}
+
+	case "end-file":
+		st.EOF = ev.Reason == "eof"
+	}
+}
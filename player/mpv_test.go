@@ -0,0 +1,90 @@
+package player
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMPVEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  Status
+	}{
+		{
+			name:  "position before playback starts",
+			lines: []string{`{"event":"property-change","id":1,"name":"time-pos","data":null}`},
+			want:  Status{},
+		},
+		{
+			name:  "position",
+			lines: []string{`{"event":"property-change","id":1,"name":"time-pos","data":12.5}`},
+			want:  Status{Position: 12.5, Started: true},
+		},
+		{
+			name: "properties",
+			lines: []string{
+				`{"event":"property-change","id":2,"name":"duration","data":3600.25}`,
+				`{"event":"property-change","id":3,"name":"pause","data":true}`,
+				`{"event":"property-change","id":4,"name":"speed","data":1.5}`,
+			},
+			want: Status{Duration: 3600.25, Paused: true, Speed: 1.5},
+		},
+		{
+			name: "command replies and bad lines are ignored",
+			lines: []string{
+				`{"data":null,"request_id":0,"error":"success"}`,
+				`{"error":"property unavailable"}`,
+				`not json`,
+				``,
+			},
+			want: Status{},
+		},
+		{
+			name: "end of file",
+			lines: []string{
+				`{"event":"property-change","id":1,"name":"time-pos","data":59}`,
+				`{"event":"end-file","reason":"eof","playlist_entry_id":1}`,
+			},
+			want: Status{Position: 59, Started: true, EOF: true},
+		},
+		{
+			name: "quit is not the end of the file",
+			lines: []string{
+				`{"event":"property-change","id":1,"name":"time-pos","data":30}`,
+				`{"event":"end-file","reason":"quit","playlist_entry_id":1}`,
+			},
+			want: Status{Position: 30, Started: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var st Status
+			for _, line := range tt.lines {
+				mpvEvent(&st, []byte(line))
+			}
+			if st != tt.want {
+				t.Errorf("got %+v, want %+v", st, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFFDuration(t *testing.T) {
+	tests := []struct {
+		line string
+		want float64
+	}{
+		{"  Duration: 01:02:03.50, start: 0.025057, bitrate: 128 kb/s", 3723.5},
+		{"  Duration: 00:00:59.00, start: 0.000000, bitrate: 64 kb/s", 59},
+		{"  Duration: N/A, start: 0.000000, bitrate: N/A", 0},
+		{"Input #0, mp3, from 'episode.mp3':", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseFFDuration(tt.line); got != tt.want {
+			t.Errorf("parseFFDuration(%q) = %v, want %v", strings.TrimSpace(tt.line), got, tt.want)
+		}
+	}
+}
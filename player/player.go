@@ -0,0 +1,145 @@
+// Package player runs external media players and tracks their state so yapa
+// knows exactly where to resume an episode.
+package player
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// Player controls an external media player
+type Player interface {
+	// Start playing source from start seconds in at the given speed
+	Start(source string, start int, speed float64) error
+	// Status returns the latest known state of the player
+	Status() Status
+	// Pause or resume playback
+	Pause(paused bool) error
+	// SetSpeed changes the playback speed
+	SetSpeed(speed float64) error
+	// Seek to position seconds into the file
+	Seek(position float64) error
+	// Stop playback, the player exits
+	Stop() error
+	// Wait for the player to exit
+	Wait() error
+}
+
+// Status of the player
+type Status struct {
+	Position float64 // Seconds into the file
+	Duration float64 // Length of the file in seconds, 0 until known
+	Paused   bool
+	Speed    float64
+	Started  bool // Set once the player has reported a position
+	EOF      bool // Set if playback reached the end of the file
+}
+
+// Default player backend
+const Default = "mpv"
+
+var backends = map[string]func() Player{
+	"mpv":     func() Player { return &MPV{} },
+	"mplayer": func() Player { return &MPlayer{} },
+	"vlc":     func() Player { return &VLC{} },
+	"ffplay":  func() Player { return &FFPlay{} },
+}
+
+// New returns the named player backend
+func New(name string) (Player, error) {
+	if name == "" {
+		name = Default
+	}
+
+	b, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown player %s, available players are %v", name, Names())
+	}
+
+	return b(), nil
+}
+
+// Names of the available player backends
+func Names() []string {
+	var out []string
+	for name := range backends {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// proc is the external process shared by the player backends
+type proc struct {
+	cmd *exec.Cmd
+
+	mu      sync.Mutex
+	status  Status
+	stopped bool
+}
+
+// prepare the process without starting it
+func (p *proc) prepare(name string, args ...string) {
+	p.cmd = exec.Command(name, args...)
+}
+
+// start the process
+func (p *proc) start(name string, args ...string) error {
+	p.prepare(name, args...)
+	return p.cmd.Start()
+}
+
+// update the status under lock
+func (p *proc) update(fn func(*Status)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fn(&p.status)
+}
+
+// Status implements Player
+func (p *proc) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.status
+}
+
+// terminate stops the process with a signal
+func (p *proc) terminate() error {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+
+	return p.cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// eofMargin is how close to the end, in seconds, a player that can't report
+// reaching it has to have got for a clean exit to count as the end of the file
+const eofMargin = 5
+
+// wait for the process to exit. Players that can't report reaching the end of
+// the file are assumed to have done so if they exit cleanly without being
+// stopped, close to the end of a file of known length. Some players also exit
+// cleanly when they can't open the file at all.
+func (p *proc) wait(detectEOF bool) error {
+	err := p.cmd.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := p.status
+	if !detectEOF && err == nil && !p.stopped && st.Duration > 0 && st.Duration-st.Position <= eofMargin {
+		p.status.EOF = true
+	}
+	if p.stopped {
+		// Being stopped is expected, not an error
+		return nil
+	}
+
+	return err
+}
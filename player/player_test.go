@@ -0,0 +1,74 @@
+package player
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestProcWaitEOF(t *testing.T) {
+	if _, err := exec.LookPath("true"); err != nil {
+		t.Skip("true is not installed")
+	}
+
+	tests := []struct {
+		name      string
+		cmd       string
+		status    Status
+		stopped   bool
+		detectEOF bool
+		wantEOF   bool
+		wantErr   bool
+	}{
+		{
+			name:    "clean exit near the end",
+			cmd:     "true",
+			status:  Status{Position: 598, Duration: 600},
+			wantEOF: true,
+		},
+		{
+			name:   "clean exit part way through",
+			cmd:    "true",
+			status: Status{Position: 120, Duration: 600},
+		},
+		{
+			name:   "clean exit with an unknown length",
+			cmd:    "true",
+			status: Status{Position: 2},
+		},
+		{
+			name:    "stopped near the end",
+			cmd:     "true",
+			status:  Status{Position: 598, Duration: 600},
+			stopped: true,
+		},
+		{
+			name:    "failed near the end",
+			cmd:     "false",
+			status:  Status{Position: 598, Duration: 600},
+			wantErr: true,
+		},
+		{
+			name:      "player reports the end itself",
+			cmd:       "true",
+			status:    Status{Position: 598, Duration: 600},
+			detectEOF: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &proc{status: tt.status, stopped: tt.stopped}
+			if err := p.start(tt.cmd); err != nil {
+				t.Fatal(err)
+			}
+
+			err := p.wait(tt.detectEOF)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("wait() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := p.Status().EOF; got != tt.wantEOF {
+				t.Errorf("EOF = %v, want %v", got, tt.wantEOF)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package player
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VLC plays files with vlc, polling its position over the rc interface
+type VLC struct {
+	proc
+	stdin io.WriteCloser
+	done  chan struct{}
+
+	// The rc interface answers queries with bare numbers so track what each
+	// answer is for
+	qmu     sync.Mutex
+	pending []string
+}
+
+// Start implements Player
+func (v *VLC) Start(source string, start int, speed float64) error {
+	v.status = Status{Position: float64(start), Speed: speed}
+	v.done = make(chan struct{})
+
+	args := []string{
+		"-I", "rc", "--rc-fake-tty",
+		"--no-video", "--play-and-exit",
+		fmt.Sprintf("--rate=%.2f", speed),
+	}
+	if start > 0 {
+		args = append(args, fmt.Sprintf("--start-time=%d", start))
+	}
+	args = append(args, source)
+
+	v.prepare("vlc", args...)
+	stdout, err := v.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if v.stdin, err = v.cmd.StdinPipe(); err != nil {
+		return err
+	}
+	if err := v.cmd.Start(); err != nil {
+		return err
+	}
+
+	go v.listen(stdout)
+	go v.poll()
+	return nil
+}
+
+// Pause implements Player
+func (v *VLC) Pause(paused bool) error {
+	if v.Status().Paused == paused {
+		return nil
+	}
+
+	v.update(func(st *Status) { st.Paused = paused })
+	return v.send("pause")
+}
+
+// SetSpeed implements Player
+func (v *VLC) SetSpeed(speed float64) error {
+	v.update(func(st *Status) { st.Speed = speed })
+	return v.send(fmt.Sprintf("rate %.2f", speed))
+}
+
+// Seek implements Player
+func (v *VLC) Seek(position float64) error {
+	v.update(func(st *Status) { st.Position = position })
+	return v.send(fmt.Sprintf("seek %d", int(position)))
+}
+
+// Stop implements Player
+func (v *VLC) Stop() error {
+	v.mu.Lock()
+	v.stopped = true
+	v.mu.Unlock()
+
+	return v.send("shutdown")
+}
+
+// Wait implements Player
+func (v *VLC) Wait() error {
+	err := v.wait(false)
+	close(v.done)
+	return err
+}
+
+// send an rc command
+func (v *VLC) send(command string) error {
+	_, err := fmt.Fprintln(v.stdin, command)
+	return err
+}
+
+// query sends an rc command that is answered with a number
+func (v *VLC) query(command string) error {
+	v.qmu.Lock()
+	v.pending = append(v.pending, command)
+	v.qmu.Unlock()
+
+	return v.send(command)
+}
+
+// poll asks vlc for its position until it exits
+func (v *VLC) poll() {
+	tick := time.NewTicker(time.Second / 2)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			if v.Status().Duration == 0 {
+				v.query("get_length")
+			}
+			v.query("get_time")
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// listen reads answers from vlc's stdout
+func (v *VLC) listen(r io.Reader) {
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line := strings.TrimSpace(strings.TrimLeft(scan.Text(), "> "))
+
+		n, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			continue
+		}
+
+		v.qmu.Lock()
+		if len(v.pending) == 0 {
+			v.qmu.Unlock()
+			continue
+		}
+		q := v.pending[0]
+		v.pending = v.pending[1:]
+		v.qmu.Unlock()
+
+		v.update(func(st *Status) {
+			switch q {
+			case "get_time":
+				st.Position, st.Started = n, true
+			case "get_length":
+				st.Duration = n
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package pod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFmt is used to name backups so they sort by age
+const backupTimeFmt = "2006-01-02T15-04-05.000"
+
+// writeFile atomically replaces path with data. The data is written and synced
+// to a temporary file in the same directory which is then renamed over path.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once the rename has happened
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0660); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself is durable
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// backupDir is where backups of the store at path are kept
+func backupDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "backups")
+}
+
+// backup preserves the current store at path as a timestamped backup by
+// calling snapshot with the destination, then removes the oldest backups so
+// that no more than keep remain
+func backup(path string, keep int, snapshot func(dst string) error) error {
+	if keep < 1 {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		// Nothing to back up yet
+		return nil
+	}
+
+	dir := backupDir(path)
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return err
+	}
+
+	var (
+		ext  = filepath.Ext(path)
+		name = strings.TrimSuffix(filepath.Base(path), ext)
+		dst  = filepath.Join(dir, fmt.Sprintf("%s-%s%s", name, time.Now().Format(backupTimeFmt), ext))
+	)
+
+	if err := snapshot(dst); err != nil {
+		return err
+	}
+
+	backups, err := Backups(path)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Backups lists the backups of the store at path, newest first
+func Backups(path string) ([]string, error) {
+	var (
+		ext  = filepath.Ext(path)
+		name = strings.TrimSuffix(filepath.Base(path), ext)
+	)
+
+	out, err := filepath.Glob(filepath.Join(backupDir(path), name+"-*"+ext))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(out)))
+	return out, nil
+}
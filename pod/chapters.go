@@ -0,0 +1,316 @@
+package pod
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// maxID3Size caps how much of an enclosure is read looking for chapters.
+// Tags are mostly artwork so anything larger is unlikely to be worth it.
+const maxID3Size = 32 << 20
+
+// Chapter of an episode
+type Chapter struct {
+	Start float64 `json:"start"` // Seconds into the episode
+	Title string  `json:"title"`
+	URL   string  `json:"url,omitempty"`
+	Image string  `json:"image,omitempty"`
+}
+
+// Chapters of an episode, in order
+type Chapters []Chapter
+
+// At returns the index of the chapter playing at pos seconds, or -1 if pos is
+// before the first chapter
+func (c Chapters) At(pos float64) int {
+	return sort.Search(len(c), func(i int) bool { return c[i].Start > pos }) - 1
+}
+
+// String implements the Stringer interface
+func (c Chapters) String() string {
+	var out []string
+	for i, ch := range c {
+		out = append(out, fmt.Sprintf("%d: %s %s", i, ParseElapsed(int(ch.Start)), ch.Title))
+	}
+
+	return strings.Join(out, "\n\t")
+}
+
+// chaptersURL finds the podcast:chapters JSON published for an item
+func chaptersURL(item *gofeed.Item) string {
+	for _, ext := range item.Extensions["podcast"]["chapters"] {
+		if ext.Attrs["url"] != "" && strings.Contains(ext.Attrs["type"], "json") {
+			return ext.Attrs["url"]
+		}
+	}
+
+	return ""
+}
+
+// chaptersRetry is how long to wait before trying to fetch chapters again
+// after failing to
+const chaptersRetry = 24 * time.Hour
+
+// ChaptersDue checks whether the episode's chapters should be fetched
+func (e *Episode) ChaptersDue() bool {
+	return !e.ChaptersLoaded && time.Since(e.ChaptersFailed) >= chaptersRetry
+}
+
+// LoadChapters fetches the episode's chapters if they haven't been already.
+// Chapters published in the feed are preferred, otherwise they're read from
+// the ID3 tag of the local copy or, failing that, the start of the enclosure.
+// An episode without chapters is only checked once and one whose chapters
+// couldn't be fetched isn't tried again for a day.
+func (e *Episode) LoadChapters(ctx context.Context) error {
+	if !e.ChaptersDue() {
+		return nil
+	}
+
+	var (
+		c   Chapters
+		err error
+	)
+	if e.ChaptersURL != "" {
+		c, err = fetchChapters(ctx, e.ChaptersURL)
+	} else {
+		c, err = id3Chapters(ctx, e.Source())
+	}
+	if err != nil {
+		e.ChaptersFailed = time.Now()
+		return err
+	}
+
+	e.Chapters, e.ChaptersLoaded, e.ChaptersFailed = c, true, time.Time{}
+	return nil
+}
+
+// LoadChapters loads the chapters of ep, an episode of f, and saves them to the
+// store. Failures are saved too, so they aren't retried every time.
+func (store *Store) LoadChapters(ctx context.Context, f *Feed, ep *Episode) error {
+	if !ep.ChaptersDue() {
+		return nil
+	}
+
+	err := ep.LoadChapters(ctx)
+	if serr := store.SaveFeed(f); serr != nil {
+		return serr
+	}
+
+	return err
+}
+
+// jsonChapters is the podcast namespace chapters format
+type jsonChapters struct {
+	Chapters []struct {
+		StartTime float64 `json:"startTime"`
+		Title     string  `json:"title"`
+		URL       string  `json:"url"`
+		Img       string  `json:"img"`
+		TOC       *bool   `json:"toc"`
+	} `json:"chapters"`
+}
+
+func fetchChapters(ctx context.Context, url string) (Chapters, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("chapters: %s", resp.Status)
+	}
+
+	var doc jsonChapters
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("chapters: %s", err)
+	}
+
+	out := Chapters{}
+	for _, ch := range doc.Chapters {
+		// Chapters left out of the table of contents are only for display
+		if ch.TOC != nil && !*ch.TOC {
+			continue
+		}
+		out = append(out, Chapter{Start: ch.StartTime, Title: ch.Title, URL: ch.URL, Image: ch.Img})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out, nil
+}
+
+// id3Chapters reads CHAP frames from the ID3v2 tag at the start of a local
+// file or url
+func id3Chapters(ctx context.Context, src string) (Chapters, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", UserAgent)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("chapters: %s", resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	// Only the tag is read, not the rest of the file
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:3]) != "ID3" {
+		return Chapters{}, nil
+	}
+
+	var (
+		version = header[3]
+		flags   = header[5]
+		size    = synchsafe(header[6:10])
+	)
+	// Unsynchronised tags would have to be decoded first, they're rare enough
+	// in podcasts not to bother
+	if (version != 3 && version != 4) || flags&0x80 != 0 || size > maxID3Size {
+		return Chapters{}, nil
+	}
+
+	tag := make([]byte, size)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return nil, fmt.Errorf("chapters: %s", err)
+	}
+
+	if flags&0x40 != 0 && len(tag) >= 4 {
+		// Skip the extended header
+		ext := int(binary.BigEndian.Uint32(tag))
+		if version == 4 {
+			ext = synchsafe(tag[:4])
+		} else {
+			ext += 4
+		}
+		if ext > len(tag) {
+			return Chapters{}, nil
+		}
+		tag = tag[ext:]
+	}
+
+	out := Chapters{}
+	for _, fr := range id3Frames(tag, version) {
+		if fr.id != "CHAP" {
+			continue
+		}
+
+		// Element ID, then start and end times in milliseconds and byte offsets
+		end := bytes.IndexByte(fr.data, 0)
+		if end < 0 || len(fr.data) < end+17 {
+			continue
+		}
+		data := fr.data[end+1:]
+		ch := Chapter{Start: float64(binary.BigEndian.Uint32(data)) / 1000}
+
+		for _, sub := range id3Frames(data[16:], version) {
+			if sub.id == "TIT2" {
+				ch.Title = id3Text(sub.data)
+			}
+		}
+
+		out = append(out, ch)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out, nil
+}
+
+type id3Frame struct {
+	id   string
+	data []byte
+}
+
+// id3Frames splits data into ID3v2.3 or 2.4 frames
+func id3Frames(data []byte, version byte) []id3Frame {
+	var out []id3Frame
+	for len(data) >= 10 && data[0] != 0 {
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		if version == 4 {
+			size = synchsafe(data[4:8])
+		}
+		if size > len(data)-10 {
+			break
+		}
+
+		out = append(out, id3Frame{id: string(data[:4]), data: data[10 : 10+size]})
+		data = data[10+size:]
+	}
+
+	return out
+}
+
+// synchsafe decodes an ID3 size, which only uses 7 bits of each byte
+func synchsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+// id3Text decodes a text frame
+func id3Text(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	enc, data := data[0], data[1:]
+	switch enc {
+	case 1, 2:
+		// UTF-16, with a byte order mark for encoding 1 and big endian for 2
+		var order binary.ByteOrder = binary.BigEndian
+		if enc == 1 && len(data) >= 2 {
+			if data[0] == 0xff && data[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			data = data[2:]
+		}
+
+		var u []uint16
+		for i := 0; i+1 < len(data); i += 2 {
+			u = append(u, order.Uint16(data[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+
+	case 3:
+		return strings.TrimRight(string(data), "\x00")
+
+	default:
+		// ISO-8859-1 maps directly to the first 256 code points
+		r := make([]rune, len(data))
+		for i, b := range data {
+			r[i] = rune(b)
+		}
+		return strings.TrimRight(string(r), "\x00")
+	}
+}
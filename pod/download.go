@@ -0,0 +1,238 @@
+package pod
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultDownloadWorkers is the number of downloads run at once if not set
+const DefaultDownloadWorkers = 4
+
+// Download states
+const (
+	Queued int32 = iota
+	Downloading
+	Finished
+	Failed
+)
+
+// Download of a single episode's enclosure to the library
+type Download struct {
+	Feed    *Feed
+	Episode *Episode
+	Path    string // Where the file will be saved
+	Size    int64  // Size given by the enclosure, 0 if unknown
+	Verify  bool   // Fail if the downloaded file doesn't match Size, rather than warn
+	Err     error
+	Warning string // Set if the file was kept although it doesn't match Size
+
+	state atomic.Int32
+	done  atomic.Int64
+	total atomic.Int64
+}
+
+// NewDownload prepares a download of ep into the library directory
+func NewDownload(library string, f *Feed, ep *Episode) *Download {
+	size, _ := strconv.ParseInt(ep.Length, 10, 64)
+	return &Download{
+		Feed:    f,
+		Episode: ep,
+		Path:    LocalPath(library, f, ep),
+		Size:    size,
+		Verify:  true,
+	}
+}
+
+// State of the download
+func (d *Download) State() int32 {
+	return d.state.Load()
+}
+
+// Progress returns the bytes downloaded so far and the total expected, which
+// is 0 if the size isn't known
+func (d *Download) Progress() (int64, int64) {
+	return d.done.Load(), d.total.Load()
+}
+
+// DownloadAll runs the downloads using the given number of workers. Each
+// download's Err is set if it fails and the episode's File is set if it
+// succeeds.
+func DownloadAll(ctx context.Context, downloads []*Download, workers int) {
+	if workers < 1 {
+		workers = DefaultDownloadWorkers
+	}
+
+	var (
+		jobs = make(chan *Download)
+		wg   sync.WaitGroup
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for d := range jobs {
+				d.state.Store(Downloading)
+				if d.Err = d.run(ctx); d.Err != nil {
+					d.state.Store(Failed)
+					continue
+				}
+
+				d.Episode.File = d.Path
+				d.state.Store(Finished)
+			}
+		}()
+	}
+
+	for _, d := range downloads {
+		jobs <- d
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// run downloads the file. Data is written to a .part file which is resumed
+// with a Range request if it already exists, and renamed once complete.
+func (d *Download) run(ctx context.Context) error {
+	if err := os.MkdirAll(filepath.Dir(d.Path), 0770); err != nil {
+		return err
+	}
+
+	part := d.Path + ".part"
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.Episode.Mp3, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Resuming
+
+	case http.StatusOK:
+		// Either a fresh download or the server ignored the Range header
+		if offset > 0 {
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			if offset, err = f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part file is already complete
+		return d.finish(f, part, offset, offset)
+
+	default:
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	var expected int64
+	if resp.ContentLength > 0 {
+		expected = offset + resp.ContentLength
+	}
+	d.total.Store(expected)
+	if expected == 0 {
+		d.total.Store(d.Size)
+	}
+	d.done.Store(offset)
+
+	n, err := io.Copy(f, io.TeeReader(resp.Body, progressWriter{&d.done}))
+	if err != nil {
+		return err
+	}
+
+	return d.finish(f, part, offset+n, expected)
+}
+
+// finish verifies and syncs the part file and moves it into place
+func (d *Download) finish(f *os.File, part string, size, expected int64) error {
+	if expected > 0 && size != expected {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", size, expected)
+	}
+	if d.Size > 0 && size != d.Size {
+		if d.Verify {
+			os.Remove(part)
+			return fmt.Errorf("size mismatch: got %d bytes, enclosure length is %d", size, d.Size)
+		}
+		d.Warning = fmt.Sprintf("got %d bytes, enclosure length is %d", size, d.Size)
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(part, d.Path)
+}
+
+// progressWriter counts bytes written to it
+type progressWriter struct {
+	n *atomic.Int64
+}
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	p.n.Add(int64(len(b)))
+	return len(b), nil
+}
+
+var unsafeChars = regexp.MustCompile(`[^\pL\pN\-_. ]+`)
+
+// sanitize makes a string safe to use as a file name
+func sanitize(s string) string {
+	s = strings.TrimSpace(unsafeChars.ReplaceAllString(s, ""))
+	if s == "" {
+		s = "untitled"
+	}
+	if r := []rune(s); len(r) > 100 {
+		s = string(r[:100])
+	}
+
+	return s
+}
+
+// LocalPath returns where an episode is saved within the library directory
+func LocalPath(library string, f *Feed, ep *Episode) string {
+	ext := ".mp3"
+	if u, err := url.Parse(ep.Mp3); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+
+	name := fmt.Sprintf("%s %s%s", ep.Published.Format("2006-01-02"), sanitize(ep.Title), ext)
+	return filepath.Join(expandHome(library), sanitize(f.Title), name)
+}
@@ -0,0 +1,135 @@
+package pod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// UserAgent is sent with every request yapa makes
+const UserAgent = "yapa (+https://github.com/nboughton/yapa)"
+
+// maxCacheAge caps how long a Cache-Control or Retry-After header can put off a refresh
+const maxCacheAge = 24 * time.Hour
+
+var (
+	// ErrNotModified is returned when the host reports the feed hasn't changed
+	ErrNotModified = errors.New("not modified")
+	// ErrCached is returned when the host asked us not to check again yet
+	ErrCached = errors.New("cached")
+)
+
+// cache holds the HTTP caching state for a feed
+type cache struct {
+	ETag         string
+	LastModified string
+	NextCheck    time.Time
+}
+
+// fetch requests and parses a feed document, sending any validators in c so that
+// the host can reply 304 Not Modified. A nil feed with a nil error means the
+// document is unchanged. The returned cache reflects the response headers.
+func fetch(ctx context.Context, url string, c cache) (*gofeed.Feed, cache, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, c, err
+	}
+
+	req.Header.Set("User-Agent", UserAgent)
+	if c.ETag != "" {
+		req.Header.Set("If-None-Match", c.ETag)
+	}
+	if c.LastModified != "" {
+		req.Header.Set("If-Modified-Since", c.LastModified)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, c, err
+	}
+	defer resp.Body.Close()
+
+	now := time.Now()
+	c.NextCheck = time.Time{}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		c.NextCheck = maxAge(resp.Header, now)
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			c.ETag = etag
+		}
+		return nil, c, nil
+
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		c.NextCheck = retryAfter(resp.Header, now)
+		return nil, c, fmt.Errorf("%s", resp.Status)
+
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, c, fmt.Errorf("%s", resp.Status)
+	}
+
+	f, err := gofeed.NewParser().Parse(resp.Body)
+	if err != nil {
+		return nil, c, err
+	}
+
+	c.ETag = resp.Header.Get("ETag")
+	c.LastModified = resp.Header.Get("Last-Modified")
+	c.NextCheck = maxAge(resp.Header, now)
+	return f, c, nil
+}
+
+// maxAge reads the Cache-Control header and returns the time the response
+// stops being fresh, or the zero time if it shouldn't be cached
+func maxAge(h http.Header, now time.Time) time.Time {
+	var age time.Duration
+	for _, d := range strings.Split(h.Get("Cache-Control"), ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+
+		switch {
+		case d == "no-cache" || d == "no-store":
+			return time.Time{}
+		case strings.HasPrefix(d, "max-age="):
+			n, err := strconv.Atoi(strings.TrimPrefix(d, "max-age="))
+			if err == nil && n > 0 {
+				age = time.Duration(n) * time.Second
+			}
+		}
+	}
+
+	if age == 0 {
+		return time.Time{}
+	}
+	if age > maxCacheAge {
+		age = maxCacheAge
+	}
+
+	return now.Add(age)
+}
+
+// retryAfter reads the Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(h http.Header, now time.Time) time.Time {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return time.Time{}
+	}
+
+	var next time.Time
+	if n, err := strconv.Atoi(v); err == nil {
+		next = now.Add(time.Duration(n) * time.Second)
+	} else if t, err := http.ParseTime(v); err == nil {
+		next = t
+	}
+
+	if next.After(now.Add(maxCacheAge)) {
+		next = now.Add(maxCacheAge)
+	}
+
+	return next
+}
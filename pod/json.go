@@ -0,0 +1,336 @@
+package pod
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// document is the layout of the JSON store
+type document struct {
+	Version int               `json:"version"`
+	Feeds   Feeds             `json:"feeds"`
+	Queue   Queue             `json:"queue"`
+	Smart   map[string]*Query `json:"smart_playlists"`
+}
+
+// jsonBackend keeps the store in a single JSON file which is rewritten in full
+// on every change
+type jsonBackend struct {
+	path string
+	keep int
+
+	// Backups are taken once per process, before the first write
+	backedUp bool
+
+	// The feeds as they were when this process last read or wrote them, used
+	// to work out which changes are ours when merging on write
+	base map[string]*Feed
+}
+
+func openJSON(path string, backups int) (*jsonBackend, error) {
+	return &jsonBackend{path: path, keep: backups, base: make(map[string]*Feed)}, nil
+}
+
+// Load implements Backend. Stores written by older versions of yapa are
+// upgraded first.
+func (j *jsonBackend) Load() (Feeds, error) {
+	if err := j.migrate(); err != nil {
+		return Feeds{}, err
+	}
+
+	doc, err := j.read()
+	if err != nil {
+		return doc.Feeds, err
+	}
+
+	feeds := doc.Feeds
+
+	for _, f := range feeds {
+		j.base[f.RSS] = f.clone()
+	}
+
+	return feeds, nil
+}
+
+// SaveFeed implements Backend. Another yapa process may have written to the
+// store since we read it, so with the store locked it is re-read and only the
+// changes made by this process are applied on top.
+func (j *jsonBackend) SaveFeed(feeds ...*Feed) error {
+	return j.update(func(doc *document) error {
+		onDisk := doc.Feeds.byRSS()
+
+		for _, f := range feeds {
+			d, b := onDisk[f.RSS], j.base[f.RSS]
+
+			switch {
+			case d == nil && b != nil:
+				// Deleted by another process
+				continue
+
+			case d == nil:
+				// Added by this process
+				doc.Feeds = append(doc.Feeds, f)
+
+			default:
+				if b == nil {
+					b = &Feed{}
+				}
+				if err := mergeFeed(d, b, f); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, f := range feeds {
+			j.base[f.RSS] = f.clone()
+		}
+
+		return nil
+	})
+}
+
+// SaveEpisode implements Backend. The whole file is rewritten regardless so
+// this is no cheaper than saving the feed.
+func (j *jsonBackend) SaveEpisode(f *Feed, eps ...*Episode) error {
+	return j.SaveFeed(f)
+}
+
+// DeleteFeed implements Backend
+func (j *jsonBackend) DeleteFeed(f *Feed) error {
+	return j.update(func(doc *document) error {
+		out := Feeds{}
+		for _, d := range doc.Feeds {
+			if d.RSS != f.RSS {
+				out = append(out, d)
+			}
+		}
+		doc.Feeds = out
+
+		q := Queue{}
+		for _, it := range doc.Queue {
+			if it.Feed != f.RSS {
+				q = append(q, it)
+			}
+		}
+		doc.Queue = q
+
+		delete(j.base, f.RSS)
+		return nil
+	})
+}
+
+// Playlists implements Backend
+func (j *jsonBackend) Playlists(f *Feed) (map[string][]int, error) {
+	doc, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+
+	if d, ok := doc.Feeds.byRSS()[f.RSS]; ok {
+		// Map the playlists on disk onto the IDs of the episodes we have
+		out := &Feed{Episodes: f.Episodes}
+		out.setPlaylists(d.playlistKeys())
+		return out.Playlists, nil
+	}
+
+	return nil, nil
+}
+
+// Queue implements Backend
+func (j *jsonBackend) Queue() (Queue, error) {
+	doc, err := j.read()
+	if os.IsNotExist(err) {
+		return Queue{}, nil
+	}
+
+	return doc.Queue, err
+}
+
+// UpdateQueue implements Backend
+func (j *jsonBackend) UpdateQueue(fn func(Queue) Queue) (Queue, error) {
+	var q Queue
+	err := j.update(func(doc *document) error {
+		doc.Queue = fn(doc.Queue)
+		q = doc.Queue
+		return nil
+	})
+
+	return q, err
+}
+
+// SmartPlaylists implements Backend
+func (j *jsonBackend) SmartPlaylists() (map[string]*Query, error) {
+	doc, err := j.read()
+	if os.IsNotExist(err) {
+		return make(map[string]*Query), nil
+	}
+
+	return doc.Smart, err
+}
+
+// SaveSmartPlaylist implements Backend
+func (j *jsonBackend) SaveSmartPlaylist(name string, q *Query) error {
+	return j.update(func(doc *document) error {
+		if q == nil {
+			delete(doc.Smart, name)
+		} else {
+			doc.Smart[name] = q
+		}
+
+		return nil
+	})
+}
+
+// Backups implements Backend
+func (j *jsonBackend) Backups() ([]string, error) {
+	return Backups(j.path)
+}
+
+// Restore implements Backend
+func (j *jsonBackend) Restore(backupPath string) error {
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the backup is a readable store before we replace anything
+	var doc document
+	upgraded, _, err := upgradeJSON(data)
+	if err == nil {
+		err = json.Unmarshal(upgraded, &doc)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid backup %s: %s", backupPath, err)
+	}
+
+	unlock, err := lock(j.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := backup(j.path, j.keep, j.snapshot); err != nil {
+		return err
+	}
+	if err := writeFile(j.path, data); err != nil {
+		return err
+	}
+
+	j.base = make(map[string]*Feed)
+	j.backedUp = true
+	return nil
+}
+
+// Close implements Backend
+func (j *jsonBackend) Close() error {
+	return nil
+}
+
+// read decodes the store, upgrading it in memory if it's an older version
+func (j *jsonBackend) read() (*document, error) {
+	doc := &document{Version: jsonVersion, Feeds: Feeds{}, Queue: Queue{}, Smart: make(map[string]*Query)}
+
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return doc, err
+	}
+
+	if data, _, err = upgradeJSON(data); err != nil {
+		return doc, err
+	}
+
+	err = json.Unmarshal(data, doc)
+	return doc, err
+}
+
+// update locks and reads the store, passes it to fn and writes the result. The
+// data is written to a temporary file which then replaces the store so an
+// interrupted write can't corrupt it.
+func (j *jsonBackend) update(fn func(*document) error) error {
+	unlock, err := lock(j.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := j.read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := fn(doc); err != nil {
+		return err
+	}
+
+	doc.Version = jsonVersion
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := j.backup(); err != nil {
+		return err
+	}
+
+	return writeFile(j.path, data)
+}
+
+// backup takes a backup of the store before this process first writes to it.
+// Backing up on every write would push the older backups out within a single
+// session.
+func (j *jsonBackend) backup() error {
+	if j.backedUp {
+		return nil
+	}
+	j.backedUp = true
+
+	return backup(j.path, j.keep, j.snapshot)
+}
+
+// migrate upgrades the store on disk to the current schema version, taking a
+// backup first
+func (j *jsonBackend) migrate() error {
+	unlock, err := lock(j.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return err
+	}
+
+	upgraded, migrated, err := upgradeJSON(data)
+	if err != nil || !migrated {
+		return err
+	}
+
+	// Always keep a copy of the old version, even if backups are turned off
+	keep := j.keep
+	if keep < 1 {
+		keep = 1
+	}
+	if err := backup(j.path, keep, j.snapshot); err != nil {
+		return err
+	}
+
+	return writeFile(j.path, upgraded)
+}
+
+// snapshot preserves the current store at dst. The store is always replaced
+// rather than rewritten so a hard link is enough to keep the old version. Fall
+// back to a copy if the filesystem won't link.
+func (j *jsonBackend) snapshot(dst string) error {
+	if err := os.Link(j.path, dst); err == nil || os.IsExist(err) {
+		return nil
+	}
+
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(dst, data)
+}
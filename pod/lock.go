@@ -0,0 +1,25 @@
+package pod
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive advisory lock on the store at path, blocking until
+// any other yapa process has released it. Call the returned func to unlock.
+func lock(path string) (func(), error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0660)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
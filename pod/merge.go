@@ -0,0 +1,161 @@
+package pod
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// mergeFeed applies the changes made to m since b onto d. Changes made by other
+// processes (played flags, new episodes) are left alone unless this process
+// changed the same thing, in which case ours wins.
+func mergeFeed(d, b, m *Feed) error {
+	var (
+		lists      = d.playlistKeys()
+		dh, bh, mh = *d, *b, *m
+		nf         Feed
+	)
+
+	// Only compare the feed level fields here
+	dh.Episodes, bh.Episodes, mh.Episodes = nil, nil, nil
+	if err := patch(&nf, &dh, &bh, &mh, "playlists"); err != nil {
+		return err
+	}
+	nf.Episodes = d.Episodes
+
+	// Episodes
+	var (
+		onDisk = d.Episodes.byKey()
+		inBase = b.Episodes.byKey()
+	)
+
+	for _, me := range m.Episodes {
+		de, be := onDisk[me.Key()], inBase[me.Key()]
+
+		switch {
+		case de == nil && be == nil:
+			// New episode found by this process
+			ep := *me
+			nf.Episodes = append(nf.Episodes, &ep)
+
+		case de == nil:
+			// Gone from the other side, leave it that way
+
+		case reflect.DeepEqual(me, be):
+			// Unchanged by this process
+
+		default:
+			if be == nil {
+				be = &Episode{}
+			}
+
+			var ne Episode
+			if err := patch(&ne, de, be, me, "id"); err != nil {
+				return err
+			}
+			*de = ne
+		}
+	}
+
+	// Episodes whose key we changed, i.e. a GUID has been found for them
+	inMine := m.Episodes.byKey()
+	for k := range inBase {
+		if _, ok := inMine[k]; !ok {
+			nf.Episodes = nf.Episodes.without(k)
+		}
+	}
+
+	// Playlists are stored by position so compare them by episode key
+	var (
+		baseLists = b.playlistKeys()
+		mineLists = m.playlistKeys()
+	)
+
+	for name, keys := range mineLists {
+		if !equalKeys(keys, baseLists[name]) {
+			lists[name] = keys
+		}
+	}
+	for name := range baseLists {
+		if _, ok := mineLists[name]; !ok {
+			delete(lists, name)
+		}
+	}
+
+	sort.Stable(nf.Episodes)
+	nf.Episodes.setIDs()
+	nf.Playlists = nil
+	nf.setPlaylists(lists)
+
+	*d = nf
+	return nil
+}
+
+// patch decodes theirs into out with any top level json fields that differ
+// between base and mine replaced by mine's version
+func patch(out, theirs, base, mine interface{}, skip ...string) error {
+	var t, b, m map[string]json.RawMessage
+	for _, v := range []struct {
+		src interface{}
+		dst *map[string]json.RawMessage
+	}{{theirs, &t}, {base, &b}, {mine, &m}} {
+		data, err := json.Marshal(v.src)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, v.dst); err != nil {
+			return err
+		}
+	}
+
+	skipped := make(map[string]bool)
+	for _, k := range skip {
+		skipped[k] = true
+	}
+
+	for k, v := range m {
+		if !skipped[k] && !bytes.Equal(v, b[k]) {
+			t[k] = v
+		}
+	}
+
+	// Fields we cleared that are omitted when empty
+	for k := range b {
+		if _, ok := m[k]; !ok && !skipped[k] {
+			delete(t, k)
+		}
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// without returns the episodes minus any with the given key
+func (e Episodes) without(key string) Episodes {
+	out := Episodes{}
+	for _, ep := range e {
+		if ep.Key() != key {
+			out = append(out, ep)
+		}
+	}
+
+	return out
+}
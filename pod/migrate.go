@@ -0,0 +1,188 @@
+package pod
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Schema versions written by this version of yapa
+const (
+	jsonVersion   = 4
+	sqliteVersion = 3
+)
+
+// jsonMigrations upgrade a JSON store from the version they are keyed by to
+// the next version
+var jsonMigrations = map[int]func([]byte) ([]byte, error){
+	// v1 (yapa 0.8.0) stores are a bare list of feeds
+	1: func(data []byte) ([]byte, error) {
+		var feeds json.RawMessage
+		if err := json.Unmarshal(data, &feeds); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(map[string]interface{}{"version": 2, "feeds": feeds})
+	},
+	// v3 adds the listening queue. Older versions would drop it when writing
+	// the store so the version is bumped to stop them.
+	2: func(data []byte) ([]byte, error) {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+
+		doc["version"] = json.RawMessage("3")
+		doc["queue"] = json.RawMessage("[]")
+		return json.Marshal(doc)
+	},
+	// v4 adds smart playlists
+	3: func(data []byte) ([]byte, error) {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+
+		doc["version"] = json.RawMessage("4")
+		doc["smart_playlists"] = json.RawMessage("{}")
+		return json.Marshal(doc)
+	},
+}
+
+// sqliteMigrations upgrade an SQLite store from the version they are keyed by
+// to the next version
+var sqliteMigrations = map[int]func(*sql.Tx) error{
+	0: func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS feeds (
+				rss  TEXT PRIMARY KEY,
+				data TEXT NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS episodes (
+				feed    TEXT NOT NULL,
+				key     TEXT NOT NULL,
+				data    TEXT NOT NULL,
+				played  INTEGER NOT NULL DEFAULT 0,
+				elapsed INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (feed, key)
+			);
+			CREATE TABLE IF NOT EXISTS playlists (
+				feed     TEXT NOT NULL,
+				name     TEXT NOT NULL,
+				episodes TEXT NOT NULL,
+				PRIMARY KEY (feed, name)
+			);`)
+		return err
+	},
+	1: func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS queue (
+				pos     INTEGER PRIMARY KEY,
+				feed    TEXT NOT NULL,
+				episode TEXT NOT NULL
+			);`)
+		return err
+	},
+	2: func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS smart_playlists (
+				name  TEXT PRIMARY KEY,
+				query TEXT NOT NULL
+			);`)
+		return err
+	},
+}
+
+// errTooNew is returned for stores written by a newer version of yapa
+func errTooNew(version, supported int) error {
+	return fmt.Errorf("store schema version %d is newer than this version of yapa supports (%d), please upgrade yapa", version, supported)
+}
+
+// jsonSchemaVersion reads the schema version of a JSON store
+func jsonSchemaVersion(data []byte) (int, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return 1, nil
+	}
+
+	var v struct {
+		Version int `json:"version"`
+	}
+	err := json.Unmarshal(data, &v)
+	return v.Version, err
+}
+
+// upgradeJSON runs any migrations needed to bring a JSON store up to the
+// current version and reports whether there were any
+func upgradeJSON(data []byte) ([]byte, bool, error) {
+	v, err := jsonSchemaVersion(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if v > jsonVersion {
+		return nil, false, errTooNew(v, jsonVersion)
+	}
+
+	for from := v; from < jsonVersion; from++ {
+		m, ok := jsonMigrations[from]
+		if !ok {
+			return nil, false, fmt.Errorf("no migration from store schema version %d", from)
+		}
+		if data, err = m(data); err != nil {
+			return nil, false, fmt.Errorf("migrating store from schema version %d: %s", from, err)
+		}
+	}
+
+	return data, v != jsonVersion, nil
+}
+
+// upgradeSQLite runs any migrations needed to bring an SQLite store up to the
+// current version. backup is called first if there is existing data to migrate.
+func upgradeSQLite(db *sql.DB, backup func() error) error {
+	var v int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&v); err != nil {
+		return err
+	}
+	if v > sqliteVersion {
+		return errTooNew(v, sqliteVersion)
+	}
+	if v == sqliteVersion {
+		return nil
+	}
+
+	var tables int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master`).Scan(&tables); err != nil {
+		return err
+	}
+	if tables > 0 {
+		if err := backup(); err != nil {
+			return err
+		}
+	}
+
+	for from := v; from < sqliteVersion; from++ {
+		m, ok := sqliteMigrations[from]
+		if !ok {
+			return fmt.Errorf("no migration from store schema version %d", from)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := m(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrating store from schema version %d: %s", from, err)
+		}
+		// PRAGMA doesn't take bound parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, from+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package pod
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Stores as older versions of yapa wrote them, with one feed and a played episode
+const (
+	jsonV1 = `[{"title":"Old Show","rss":"http://example.com/rss","episodes":[{"id":0,"title":"One","mp3":"http://example.com/1.mp3","played":true}],"playlists":{}}]`
+	jsonV2 = `{"version":2,"feeds":[{"title":"Old Show","rss":"http://example.com/rss","episodes":[{"id":0,"title":"One","mp3":"http://example.com/1.mp3","played":true}],"playlists":{}}]}`
+
+	sqliteV0 = `
+		CREATE TABLE feeds (rss TEXT PRIMARY KEY, data TEXT NOT NULL);
+		CREATE TABLE episodes (
+			feed TEXT NOT NULL, key TEXT NOT NULL, data TEXT NOT NULL,
+			played INTEGER NOT NULL DEFAULT 0, elapsed INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (feed, key)
+		);
+		CREATE TABLE playlists (feed TEXT NOT NULL, name TEXT NOT NULL, episodes TEXT NOT NULL, PRIMARY KEY (feed, name));
+		INSERT INTO feeds VALUES ('http://example.com/rss', '{"title":"Old Show","rss":"http://example.com/rss"}');
+		INSERT INTO episodes VALUES ('http://example.com/rss', 'http://example.com/1.mp3', '{"title":"One","mp3":"http://example.com/1.mp3"}', 1, 0);`
+)
+
+// writeRaw writes data to path as is
+func writeRaw(t *testing.T, path, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0660); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeSQLite creates an SQLite store at path by running stmts
+func writeSQLite(t *testing.T, path, stmts string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(stmts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// schemaVersion reads the schema version of the store at path from disk
+func schemaVersion(t *testing.T, path string) int {
+	t.Helper()
+
+	if filepath.Ext(path) == ".json" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := jsonSchemaVersion(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var v int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		write       func(t *testing.T, path string)
+		wantErr     string
+		wantFeeds   int
+		wantBackups int
+		wantVersion int
+	}{
+		{
+			name:        "json version 1",
+			file:        "store.json",
+			write:       func(t *testing.T, path string) { writeRaw(t, path, jsonV1) },
+			wantFeeds:   1,
+			wantBackups: 1,
+			wantVersion: jsonVersion,
+		},
+		{
+			name:        "json version 2",
+			file:        "store.json",
+			write:       func(t *testing.T, path string) { writeRaw(t, path, jsonV2) },
+			wantFeeds:   1,
+			wantBackups: 1,
+			wantVersion: jsonVersion,
+		},
+		{
+			name:    "json from a newer yapa",
+			file:    "store.json",
+			write:   func(t *testing.T, path string) { writeRaw(t, path, `{"version":99,"feeds":[]}`) },
+			wantErr: "newer than this version",
+		},
+		{
+			name:        "sqlite version 0",
+			file:        "store.db",
+			write:       func(t *testing.T, path string) { writeSQLite(t, path, sqliteV0) },
+			wantFeeds:   1,
+			wantBackups: 1,
+			wantVersion: sqliteVersion,
+		},
+		{
+			name:        "empty sqlite file",
+			file:        "store.db",
+			write:       func(t *testing.T, path string) { writeRaw(t, path, "") },
+			wantVersion: sqliteVersion,
+		},
+		{
+			name:    "sqlite from a newer yapa",
+			file:    "store.db",
+			write:   func(t *testing.T, path string) { writeSQLite(t, path, `PRAGMA user_version = 99`) },
+			wantErr: "newer than this version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			tt.write(t, path)
+
+			store, err := ReadStore(path, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			if len(store.Feeds) != tt.wantFeeds {
+				t.Fatalf("got %d feeds, want %d", len(store.Feeds), tt.wantFeeds)
+			}
+			for _, f := range store.Feeds {
+				if f.Title != "Old Show" || len(f.Episodes) != 1 || !f.Episodes[0].Played {
+					t.Errorf("feed not carried over: %+v", f)
+				}
+			}
+			if store.Queue == nil || store.Smart == nil {
+				t.Error("queue or smart playlists missing after migration")
+			}
+
+			backups, err := store.Backups()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(backups) != tt.wantBackups {
+				t.Errorf("got %d backups, want %d", len(backups), tt.wantBackups)
+			}
+			if v := schemaVersion(t, path); v != tt.wantVersion {
+				t.Errorf("schema version on disk = %d, want %d", v, tt.wantVersion)
+			}
+
+			// The upgraded store takes writes to the tables added since
+			if _, err := store.backend.UpdateQueue(func(q Queue) Queue { return q }); err != nil {
+				t.Error(err)
+			}
+			if err := store.backend.SaveSmartPlaylist("unplayed", &Query{}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
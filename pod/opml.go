@@ -0,0 +1,144 @@
+package pod
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"time"
+)
+
+// OPML document, as used to move subscriptions between podcast apps
+type OPML struct {
+	XMLName xml.Name  `xml:"opml"`
+	Version string    `xml:"version,attr"`
+	Title   string    `xml:"head>title"`
+	Created string    `xml:"head>dateCreated,omitempty"`
+	Body    []Outline `xml:"body>outline"`
+}
+
+// Outline is an OPML outline element. Feeds have an xmlUrl, anything else is a
+// category containing further outlines.
+type Outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []Outline `xml:"outline"`
+}
+
+// Subscription is a feed listed in an OPML file
+type Subscription struct {
+	Title      string
+	RSS        string
+	URL        string
+	Categories []string // Titles of the outlines the feed was nested in
+}
+
+// ReadOPML reads the subscriptions from an OPML document, flattening any
+// nested categories. A feed listed under several categories is returned once
+// with all of them.
+func ReadOPML(r io.Reader) ([]Subscription, error) {
+	var doc OPML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var (
+		out  []Subscription
+		seen = make(map[string]int)
+		walk func([]Outline, []string)
+	)
+
+	walk = func(outlines []Outline, categories []string) {
+		for _, o := range outlines {
+			title := o.Title
+			if title == "" {
+				title = o.Text
+			}
+
+			if i, ok := seen[o.XMLURL]; ok {
+				for _, c := range categories {
+					if !contains(out[i].Categories, c) {
+						out[i].Categories = append(out[i].Categories, c)
+					}
+				}
+			} else if o.XMLURL != "" {
+				seen[o.XMLURL] = len(out)
+				out = append(out, Subscription{
+					Title:      title,
+					RSS:        o.XMLURL,
+					URL:        o.HTMLURL,
+					Categories: categories,
+				})
+			}
+
+			if len(o.Outlines) > 0 {
+				walk(o.Outlines, append(categories[:len(categories):len(categories)], title))
+			}
+		}
+	}
+	walk(doc.Body, nil)
+
+	return out, nil
+}
+
+// WriteOPML writes the feeds as an OPML document. Tagged feeds are nested in
+// a category outline for each of their tags, anything untagged is left at the
+// top level.
+func WriteOPML(w io.Writer, feeds Feeds) error {
+	doc := OPML{
+		Version: "2.0",
+		Title:   "yapa subscriptions",
+		Created: time.Now().Format(time.RFC1123Z),
+	}
+
+	var (
+		tags  []string
+		byTag = make(map[string][]Outline)
+		loose []Outline
+	)
+	for _, f := range feeds {
+		if len(f.Tags) == 0 {
+			loose = append(loose, f.outline())
+			continue
+		}
+
+		for _, t := range f.Tags {
+			if _, ok := byTag[t]; !ok {
+				tags = append(tags, t)
+			}
+			byTag[t] = append(byTag[t], f.outline())
+		}
+	}
+
+	sort.Strings(tags)
+	for _, t := range tags {
+		doc.Body = append(doc.Body, Outline{Text: t, Title: t, Outlines: byTag[t]})
+	}
+	doc.Body = append(doc.Body, loose...)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// outline for a feed
+func (f *Feed) outline() Outline {
+	return Outline{
+		Text:    f.DisplayTitle(),
+		Title:   f.Title,
+		Type:    "rss",
+		XMLURL:  f.RSS,
+		HTMLURL: f.URL,
+	}
+}
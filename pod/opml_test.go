@@ -0,0 +1,96 @@
+package pod
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadOPML(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Subscription
+	}{
+		{
+			name: "flat",
+			body: `<outline text="One" type="rss" xmlUrl="http://example.com/1" htmlUrl="http://example.com"/>
+				<outline text="Two" title="Two Show" type="rss" xmlUrl="http://example.com/2"/>`,
+			want: []Subscription{
+				{Title: "One", RSS: "http://example.com/1", URL: "http://example.com"},
+				{Title: "Two Show", RSS: "http://example.com/2"},
+			},
+		},
+		{
+			name: "nested categories",
+			body: `<outline text="Tech">
+					<outline text="Linux"><outline text="One" xmlUrl="http://example.com/1"/></outline>
+					<outline text="Go"><outline text="Two" xmlUrl="http://example.com/2"/></outline>
+					<outline text="Three" xmlUrl="http://example.com/3"/>
+				</outline>
+				<outline text="Four" xmlUrl="http://example.com/4"/>`,
+			want: []Subscription{
+				{Title: "One", RSS: "http://example.com/1", Categories: []string{"Tech", "Linux"}},
+				{Title: "Two", RSS: "http://example.com/2", Categories: []string{"Tech", "Go"}},
+				{Title: "Three", RSS: "http://example.com/3", Categories: []string{"Tech"}},
+				{Title: "Four", RSS: "http://example.com/4"},
+			},
+		},
+		{
+			name: "feed in several categories",
+			body: `<outline text="News"><outline text="One" xmlUrl="http://example.com/1"/></outline>
+				<outline text="Daily"><outline text="One" xmlUrl="http://example.com/1"/></outline>
+				<outline text="One" xmlUrl="http://example.com/1"/>`,
+			want: []Subscription{
+				{Title: "One", RSS: "http://example.com/1", Categories: []string{"News", "Daily"}},
+			},
+		},
+		{
+			name: "empty categories",
+			body: `<outline text="Nothing here"/><outline text="Or here"><outline text="Deeper"/></outline>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `<?xml version="1.0"?><opml version="2.0"><head><title>Test</title></head><body>` + tt.body + `</body></opml>`
+
+			got, err := ReadOPML(strings.NewReader(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOPMLRoundTrip(t *testing.T) {
+	feeds := Feeds{
+		{Title: "One", RSS: "http://example.com/1", URL: "http://example.com", Name: "My One", Tags: []string{"tech", "daily"}},
+		{Title: "Two", RSS: "http://example.com/2", Tags: []string{"tech"}},
+		{Title: "Three", RSS: "http://example.com/3"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteOPML(&buf, feeds); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadOPML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Categories are written in tag order and feeds keep the publisher's title
+	want := []Subscription{
+		{Title: "One", RSS: "http://example.com/1", URL: "http://example.com", Categories: []string{"daily", "tech"}},
+		{Title: "Two", RSS: "http://example.com/2", Categories: []string{"tech"}},
+		{Title: "Three", RSS: "http://example.com/3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
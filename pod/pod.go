@@ -1,11 +1,10 @@
 package pod
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
+	"html"
 	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -13,61 +12,56 @@ import (
 	"time"
 
 	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
 )
 
-const (
-	ErrorInvalidPath       = "cannot read or create store at given path"
-	ErrorStoreDoesNotExist = "no existing store found"
-)
-
-// Store is the feed collection, we load it on open and write it on changes
-type Store struct {
-	Path  string
-	Feeds Feeds `json:"feeds"`
-}
-
-// ReadStore reads in the json data
-func ReadStore(path string) (*Store, error) {
-	store := &Store{
-		// Replace ~/ with home dir
-		Path:  strings.Replace(path, "~/", os.Getenv("HOME")+"/", 1),
-		Feeds: Feeds{},
-	}
-
-	// Validate dirpath
-	dir := filepath.Dir(store.Path)
-	if err := os.MkdirAll(dir, 0770); err != nil {
-		return nil, fmt.Errorf(ErrorInvalidPath)
-	}
-
-	// Attempt to open a file there
-	f, err := os.Open(store.Path)
-	if err != nil {
-		// Return an empty store if none exists
-		return store, fmt.Errorf(ErrorStoreDoesNotExist)
-	}
-	defer f.Close()
-
-	// Read store into a Store struct
-	err = json.NewDecoder(f).Decode(&store.Feeds)
-	return store, err
+// Feed data
+type Feed struct {
+	Title    string    `json:"title"`
+	URL      string    `json:"url"`
+	RSS      string    `json:"rss"`
+	Slug     string    `json:"slug,omitempty"` // Stable name for the feed, set when it's added
+	Updated  time.Time `json:"updated"`
+	Image    string    `json:"image,omitempty"`
+	Episodes Episodes  `json:"episodes"`
+
+	// Publisher's metadata, refreshed by every update
+	Author      string           `json:"author,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Categories  []string         `json:"categories,omitempty"`
+	Type        string           `json:"type,omitempty"` // itunes:type, episodic or serial
+	Explicit    bool             `json:"explicit,omitempty"`
+	Playlists   map[string][]int `json:"playlists"`
+	Order       string           `json:"order,omitempty"` // One of Orders, auto if empty
+
+	// HTTP cache validators and the earliest time the host wants us back
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	NextCheck    time.Time `json:"next_check,omitempty"`
+
+	Policy Policy `json:"policy"`
+	Skip   Skip   `json:"skip"`
+
+	// Set with feed edit and left alone by updates
+	Name  string   `json:"name,omitempty"` // Display title, used in place of the publisher's
+	Notes string   `json:"notes,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
 }
 
-// WriteStore writes to the json store
-func WriteStore(store *Store) error {
-	f, err := os.Create(store.Path)
-	if err != nil {
-		return err
+// DisplayTitle is the feed's local name if it has one, otherwise the
+// publisher's title
+func (f *Feed) DisplayTitle() string {
+	if f.Name != "" {
+		return f.Name
 	}
-	defer f.Close()
 
-	return json.NewEncoder(f).Encode(&store.Feeds)
+	return f.Title
 }
 
-// Exists checks for an existing version of a feed in the store
-func (store *Store) Exists(name string) bool {
-	for _, f := range store.Feeds {
-		if f.Title == name {
+// Tagged checks whether the feed has tag
+func (f *Feed) Tagged(tag string) bool {
+	for _, t := range f.Tags {
+		if strings.EqualFold(t, tag) {
 			return true
 		}
 	}
@@ -75,29 +69,6 @@ func (store *Store) Exists(name string) bool {
 	return false
 }
 
-// Update the store
-func (store *Store) Update() error {
-	for i, f := range store.Feeds {
-		fmt.Printf("Updating %s\n", f.Title)
-		if err := store.Feeds[i].Update(); err != nil {
-			log.Printf("-> Update error: %s\n", err)
-		}
-	}
-
-	sort.Sort(store.Feeds)
-	return nil
-}
-
-// Feed data
-type Feed struct {
-	Title     string           `json:"title"`
-	URL       string           `json:"url"`
-	RSS       string           `json:"rss"`
-	Updated   time.Time        `json:"updated"`
-	Episodes  Episodes         `json:"episodes"`
-	Playlists map[string][]int `json:"playlists"`
-}
-
 // Played episodes
 func (f *Feed) Played() int {
 	n := 0
@@ -174,41 +145,204 @@ func (f *Feed) Playlist(s string) Episodes {
 	return out
 }
 
-// Update the feed
-func (f *Feed) Update() error {
-	latest, err := FromRSS(f.RSS)
+// Update the feed. Episodes are reconciled by their GUID (or enclosure URL if
+// the feed doesn't publish GUIDs) so that playback state stays with the right
+// episode when a publisher removes, reorders or back-inserts items. Unless force
+// is set the request is conditional and ErrNotModified or ErrCached are returned
+// if there is nothing new to fetch.
+func (f *Feed) Update(ctx context.Context, force bool) (int, error) {
+	if !force && time.Now().Before(f.NextCheck) {
+		return 0, ErrCached
+	}
+
+	var c cache
+	if !force {
+		c = cache{ETag: f.ETag, LastModified: f.LastModified}
+	}
+
+	doc, c, err := fetch(ctx, f.RSS, c)
+	f.NextCheck = c.NextCheck
 	if err != nil {
-		return err
+		return 0, err
+	}
+	f.ETag, f.LastModified = c.ETag, c.LastModified
+
+	if doc == nil {
+		return 0, ErrNotModified
+	}
+
+	latest, err := newFeed(f.RSS, doc)
+	if err != nil {
+		return 0, err
 	}
 
-	// Check if the latest publish date is different.
-	// Since we sort oldest to newest by default new episodes should only appear at the end
-	//if latest.Updated.After(f.Updated) || len(latest.Episodes) != len(f.Episodes) {
 	f.Updated = latest.Updated
+	f.Image = latest.Image
+	f.Author = latest.Author
+	f.Description = latest.Description
+	f.Categories = latest.Categories
+	f.Type = latest.Type
+	f.Explicit = latest.Explicit
+
+	var (
+		lists = f.playlistEpisodes()
+		known = f.Episodes
+		byKey = make(map[string]*Episode)
+		byMp3 = make(map[string]*Episode)
+		seen  = make(map[*Episode]bool)
+		added = 0
+	)
+
+	for _, ep := range known {
+		byKey[ep.Key()] = ep
+		byMp3[ep.Mp3] = ep
+	}
 
-	for i, ep := range latest.Episodes {
-		if i < len(f.Episodes) {
-			f.Episodes[i].ID = ep.ID
-			f.Episodes[i].Title = ep.Title
-			f.Episodes[i].URL = ep.URL
-			f.Episodes[i].Mp3 = ep.Mp3
-			f.Episodes[i].Length = ep.Length
-			f.Episodes[i].Published = ep.Published
-
-		} else if i >= len(f.Episodes) {
-			fmt.Printf("-> New episode: %s\n", ep.Title)
-			f.Episodes = append(f.Episodes, ep)
+	for _, ep := range latest.Episodes {
+		old, ok := byKey[ep.Key()]
+		if !ok {
+			// Stores written before GUIDs were recorded only have the enclosure to go on
+			if old, ok = byMp3[ep.Mp3]; ok && old.GUID != "" {
+				ok = false
+			}
 		}
+
+		if ok && !seen[old] {
+			seen[old] = true
+			if old.ChaptersURL != ep.ChaptersURL || (old.ChaptersURL == "" && old.Mp3 != ep.Mp3) {
+				// Chapters have moved, fetch them again next time
+				old.Chapters, old.ChaptersLoaded, old.ChaptersFailed = nil, false, time.Time{}
+			}
+			old.ChaptersURL = ep.ChaptersURL
+			old.Transcripts = ep.Transcripts
+			old.GUID = ep.GUID
+			old.Title = ep.Title
+			old.URL = ep.URL
+			old.Mp3 = ep.Mp3
+			old.Length = ep.Length
+			old.Duration = ep.Duration
+			old.Image = ep.Image
+			old.Season = ep.Season
+			old.Number = ep.Number
+			old.Type = ep.Type
+			old.Explicit = ep.Explicit
+			old.Published = ep.Published
+			old.Removed = false
+			continue
+		}
+
+		if f.Skip.Mark && f.Skipped(ep) {
+			ep.MarkPlayed(true)
+		}
+		f.Episodes = append(f.Episodes, ep)
+		added++
 	}
-	//}
 
-	return nil
+	// Anything we didn't see has been pulled from the feed, keep it but flag it
+	for _, ep := range known {
+		if !seen[ep] {
+			ep.Removed = true
+		}
+	}
+
+	sort.Stable(f.Episodes)
+	f.Episodes.setIDs()
+	for name, eps := range lists {
+		ids := []int{}
+		for _, ep := range eps {
+			ids = append(ids, ep.ID)
+		}
+		f.Playlists[name] = ids
+	}
+
+	return added, nil
+}
+
+// playlistEpisodes resolves playlists of episode IDs to the episodes
+// themselves. Unlike keys, which change when an episode's GUID is first seen,
+// they survive an update.
+func (f *Feed) playlistEpisodes() map[string]Episodes {
+	out := make(map[string]Episodes)
+	for name, list := range f.Playlists {
+		out[name] = Episodes{}
+		for _, id := range list {
+			if id >= 0 && id < len(f.Episodes) {
+				out[name] = append(out[name], f.Episodes[id])
+			}
+		}
+	}
+
+	return out
+}
+
+// playlistKeys converts playlists of episode IDs to playlists of episode keys
+func (f *Feed) playlistKeys() map[string][]string {
+	out := make(map[string][]string)
+	for name, list := range f.Playlists {
+		for _, id := range list {
+			if id >= 0 && id < len(f.Episodes) {
+				out[name] = append(out[name], f.Episodes[id].Key())
+			}
+		}
+	}
+
+	return out
+}
+
+// setPlaylists rebuilds playlists of episode IDs from playlists of episode keys
+func (f *Feed) setPlaylists(lists map[string][]string) {
+	if len(lists) == 0 {
+		return
+	}
+
+	ids := make(map[string]int)
+	for _, ep := range f.Episodes {
+		ids[ep.Key()] = ep.ID
+	}
+
+	f.Playlists = make(map[string][]int)
+	for name, keys := range lists {
+		list := []int{}
+		for _, k := range keys {
+			if id, ok := ids[k]; ok {
+				list = append(list, id)
+			}
+		}
+		f.Playlists[name] = list
+	}
 }
 
 // String implements the Stringer interface
 func (f *Feed) String() string {
-	return fmt.Sprintf("Title:\t%s\nURL:\t%s\nRSS:\t%s\nUpdated:\t%s\nEpisodes:\t%d/%d\nPlaylists:\t%s\n",
-		f.Title, f.URL, f.RSS, f.Updated.Format("2006-01-02"), len(f.Episodes), f.Played(), listKeys(f.Playlists))
+	out := fmt.Sprintf("Title:\t%s\nSlug:\t%s\nURL:\t%s\nRSS:\t%s\nUpdated:\t%s\nEpisodes:\t%d/%d\nPlaylists:\t%s\nPolicy:\t%s\n",
+		f.DisplayTitle(), f.Slug, f.URL, f.RSS, f.Updated.Format("2006-01-02"), len(f.Episodes), f.Played(), listKeys(f.Playlists), f.Policy)
+	if f.Name != "" {
+		out += fmt.Sprintf("Publisher's Title:\t%s\n", f.Title)
+	}
+	if len(f.Tags) > 0 {
+		out += fmt.Sprintf("Tags:\t%s\n", strings.Join(f.Tags, ", "))
+	}
+	if f.Notes != "" {
+		out += fmt.Sprintf("Notes:\t%s\n", f.Notes)
+	}
+	if f.Author != "" {
+		out += fmt.Sprintf("Author:\t%s\n", f.Author)
+	}
+	if f.Type != "" {
+		out += fmt.Sprintf("Type:\t%s\n", f.Type)
+	}
+	out += fmt.Sprintf("Order:\t%s\nSkip:\t%s\n", f.EffectiveOrder(), f.Skip)
+	if len(f.Categories) > 0 {
+		out += fmt.Sprintf("Categories:\t%s\n", strings.Join(f.Categories, ", "))
+	}
+	if f.Explicit {
+		out += "Explicit:\ttrue\n"
+	}
+	if f.Description != "" {
+		out += fmt.Sprintf("Description:\t%s\n", oneLine(f.Description))
+	}
+
+	return out
 }
 
 func listKeys(in map[string][]int) string {
@@ -219,39 +353,152 @@ func listKeys(in map[string][]int) string {
 	return strings.Join(k, ", ")
 }
 
-// Feed list sortable by most reent update
+// Feed list, in the order the feeds were added so their IDs don't change
 type Feeds []*Feed
 
-// Implement sort interface by last update for Feeds
-func (f Feeds) Len() int           { return len(f) }
-func (f Feeds) Less(i, j int) bool { return f[i].Updated.After(f[j].Updated) }
-func (f Feeds) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+// Latest returns the index of the most recently updated feed, -1 if there
+// are none
+func (f Feeds) Latest() int {
+	latest := -1
+	for i, feed := range f {
+		if latest < 0 || feed.Updated.After(f[latest].Updated) {
+			latest = i
+		}
+	}
+
+	return latest
+}
 
 // Episode data
 type Episode struct {
 	ID        int       `json:"id"`
+	GUID      string    `json:"guid"`
 	Title     string    `json:"title"`
 	URL       string    `json:"url"`
 	Mp3       string    `json:"mp3"`
 	Length    string    `json:"length"`
+	Duration  int       `json:"duration,omitempty"` // In seconds, 0 if the feed doesn't say
+	Season    int       `json:"season,omitempty"`
+	Number    int       `json:"episode,omitempty"`      // Episode number, within the season if there is one
+	Type      string    `json:"episode_type,omitempty"` // itunes:episodeType, full, trailer or bonus
+	Explicit  bool      `json:"explicit,omitempty"`
+	Image     string    `json:"image,omitempty"` // Episode artwork, if it differs from the feed's
 	Published time.Time `json:"published"`
 	Played    bool      `json:"played"`
 	Elapsed   int       `json:"elapsed"`
+	Removed   bool      `json:"removed,omitempty"` // No longer published in the feed
+	File      string    `json:"file,omitempty"`    // Downloaded copy of the enclosure
+	PlayedAt  time.Time `json:"played_at,omitempty"`
+
+	// Chapters are fetched the first time they're needed
+	ChaptersURL    string    `json:"chapters_url,omitempty"` // podcast:chapters JSON
+	Chapters       Chapters  `json:"chapters,omitempty"`
+	ChaptersLoaded bool      `json:"chapters_loaded,omitempty"`
+	ChaptersFailed time.Time `json:"chapters_failed,omitempty"` // Last failed attempt to fetch them
+
+	Transcripts []Transcript `json:"transcripts,omitempty"` // podcast:transcript links
+}
+
+// MarkPlayed sets the played state of an episode and records when it was played
+func (e *Episode) MarkPlayed(played bool) {
+	if played && !e.Played {
+		e.PlayedAt = time.Now()
+	} else if !played {
+		e.PlayedAt = time.Time{}
+	}
+
+	e.Played = played
+}
+
+// Key returns the identity used to match an episode across feed updates
+func (e *Episode) Key() string {
+	if e.GUID != "" {
+		return e.GUID
+	}
+
+	return e.Mp3
+}
+
+// EpisodeType returns the episode's itunes:episodeType, episodes that don't
+// give one are full episodes
+func (e *Episode) EpisodeType() string {
+	if e.Type == "" {
+		return "full"
+	}
+
+	return e.Type
+}
+
+// Downloaded checks whether there is a local copy of the episode
+func (e *Episode) Downloaded() bool {
+	if e.File == "" {
+		return false
+	}
+
+	_, err := os.Stat(e.File)
+	return err == nil
+}
+
+// Artwork returns the episode's image, or the feed's if it doesn't have one
+func (e *Episode) Artwork(f *Feed) string {
+	if e.Image != "" {
+		return e.Image
+	}
+
+	return f.Image
+}
+
+// Source returns the local copy of the episode if there is one, otherwise the enclosure url
+func (e *Episode) Source() string {
+	if e.Downloaded() {
+		return e.File
+	}
+
+	return e.Mp3
 }
 
 // String implements the Stringer interface
 func (e *Episode) String() string {
-	return fmt.Sprintf("Title:\t%s\nID:\t%d\nURL:\t%s\nMP3:\t%s\nUpdated:\t%s\nPlayed:\t%v\nElapsed:\t%s\n",
-		e.Title, e.ID, e.URL, e.Mp3, e.Published.Format("2006-01-02"), e.Played, ParseElapsed(e.Elapsed))
+	out := fmt.Sprintf("Title:\t%s\nID:\t%d\nGUID:\t%s\nURL:\t%s\nMP3:\t%s\nFile:\t%s\nUpdated:\t%s\nDuration:\t%s\nPlayed:\t%v\nElapsed:\t%s\nRemoved:\t%v\n",
+		e.Title, e.ID, e.GUID, e.URL, e.Mp3, e.File, e.Published.Format("2006-01-02"), ParseElapsed(e.Duration), e.Played, ParseElapsed(e.Elapsed), e.Removed)
+	if e.Season > 0 {
+		out += fmt.Sprintf("Season:\t%d\n", e.Season)
+	}
+	if e.Number > 0 {
+		out += fmt.Sprintf("Episode:\t%d\n", e.Number)
+	}
+	if e.Type != "" {
+		out += fmt.Sprintf("Type:\t%s\n", e.Type)
+	}
+	if e.Explicit {
+		out += "Explicit:\ttrue\n"
+	}
+	if len(e.Chapters) > 0 {
+		out += fmt.Sprintf("Chapters:\t%s\n", e.Chapters)
+	}
+	if t, ok := e.Transcript(); ok {
+		out += fmt.Sprintf("Transcript:\t%s\n", t.URL)
+	}
+
+	return out
 }
 
 // Episodes is its own type in order to implement a sort interface
 type Episodes []*Episode
 
 // Implement sort interface by publish date for Episodes
-func (e Episodes) Len() int           { return len(e) }
-func (e Episodes) Less(i, j int) bool { return e[i].Published.Before(e[j].Published) }
-func (e Episodes) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e Episodes) Len() int { return len(e) }
+func (e Episodes) Less(i, j int) bool {
+	if !e[i].Published.Equal(e[j].Published) {
+		return e[i].Published.Before(e[j].Published)
+	}
+	// Episodes published together are put in number order
+	if e[i].Season != e[j].Season {
+		return e[i].Season < e[j].Season
+	}
+	return e[i].Number < e[j].Number
+}
+func (e Episodes) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
 
 // Set episode IDs post-sort
 func (e Episodes) setIDs() {
@@ -262,15 +509,25 @@ func (e Episodes) setIDs() {
 
 // FromRSS creates a new Feed obj by parsing data from an rss url
 func FromRSS(url string) (Feed, error) {
-	var fd Feed
-	now := time.Now()
+	return fromRSS(context.Background(), url)
+}
 
-	// Parse feed
-	f, err := gofeed.NewParser().ParseURL(url)
+func fromRSS(ctx context.Context, url string) (Feed, error) {
+	f, c, err := fetch(ctx, url, cache{})
 	if err != nil {
-		return fd, err
+		return Feed{}, err
 	}
 
+	fd, err := newFeed(url, f)
+	fd.ETag, fd.LastModified, fd.NextCheck = c.ETag, c.LastModified, c.NextCheck
+	return fd, err
+}
+
+// newFeed loads a parsed feed document into a Feed obj
+func newFeed(url string, f *gofeed.Feed) (Feed, error) {
+	var fd Feed
+	now := time.Now()
+
 	var feedPub *time.Time
 	if f.Published != "" {
 		feedPub = f.PublishedParsed
@@ -289,6 +546,31 @@ func FromRSS(url string) (Feed, error) {
 		Updated: *feedPub,
 	}
 
+	if f.Image != nil {
+		fd.Image = f.Image.URL
+	}
+	if f.Author != nil {
+		fd.Author = f.Author.Name
+	}
+	fd.Description = strings.TrimSpace(f.Description)
+	fd.Categories = f.Categories
+	if f.ITunesExt != nil {
+		if f.ITunesExt.Image != "" {
+			fd.Image = f.ITunesExt.Image
+		}
+		if f.ITunesExt.Author != "" {
+			fd.Author = f.ITunesExt.Author
+		}
+		if fd.Description == "" {
+			fd.Description = strings.TrimSpace(f.ITunesExt.Summary)
+		}
+		if cats := itunesCategories(f.ITunesExt.Categories); len(cats) > 0 {
+			fd.Categories = cats
+		}
+		fd.Type = strings.ToLower(strings.TrimSpace(f.ITunesExt.Type))
+		fd.Explicit = explicit(f.ITunesExt.Explicit)
+	}
+
 	for _, item := range f.Items {
 		var epPub *time.Time
 		if item.Published != "" {
@@ -304,13 +586,40 @@ func FromRSS(url string) (Feed, error) {
 			return fd, fmt.Errorf("invalid feed; no enclosures (i.e mp3 link) found")
 		}
 
-		fd.Episodes = append(fd.Episodes, &Episode{
-			Title:     item.Title,
-			URL:       item.Link,
-			Mp3:       item.Enclosures[0].URL,
-			Length:    item.Enclosures[0].Length,
-			Published: *epPub,
-		})
+		ep := &Episode{
+			GUID:        item.GUID,
+			Title:       item.Title,
+			URL:         item.Link,
+			Mp3:         item.Enclosures[0].URL,
+			Length:      item.Enclosures[0].Length,
+			Published:   *epPub,
+			ChaptersURL: chaptersURL(item),
+			Transcripts: transcripts(item),
+		}
+		if item.Image != nil {
+			ep.Image = item.Image.URL
+		}
+
+		// Podcasting 2.0 numbering is used if iTunes' is missing
+		ep.Season, _ = strconv.Atoi(podcastExt(item, "season"))
+		ep.Number, _ = strconv.Atoi(podcastExt(item, "episode"))
+
+		if it := item.ITunesExt; it != nil {
+			ep.Duration = parseDuration(it.Duration)
+			if it.Image != "" {
+				ep.Image = it.Image
+			}
+			if n, err := strconv.Atoi(strings.TrimSpace(it.Season)); err == nil {
+				ep.Season = n
+			}
+			if n, err := strconv.Atoi(strings.TrimSpace(it.Episode)); err == nil {
+				ep.Number = n
+			}
+			ep.Type = strings.ToLower(strings.TrimSpace(it.EpisodeType))
+			ep.Explicit = explicit(it.Explicit)
+		}
+
+		fd.Episodes = append(fd.Episodes, ep)
 	}
 
 	// Default sort by oldest first
@@ -319,6 +628,61 @@ func FromRSS(url string) (Feed, error) {
 	return fd, nil
 }
 
+// podcastExt returns the text of a podcast namespace element of an item
+func podcastExt(item *gofeed.Item, name string) string {
+	for _, e := range item.Extensions["podcast"][name] {
+		return strings.TrimSpace(e.Value)
+	}
+
+	return ""
+}
+
+// itunesCategories flattens iTunes categories and their subcategories
+func itunesCategories(in []*ext.ITunesCategory) []string {
+	var out []string
+	for _, c := range in {
+		for ; c != nil; c = c.Subcategory {
+			if c.Text != "" {
+				out = append(out, c.Text)
+			}
+		}
+	}
+
+	return out
+}
+
+// explicit reads an itunes:explicit value, which has been given as yes/no,
+// true/false and explicit/clean over the years
+func explicit(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "true", "explicit":
+		return true
+	}
+
+	return false
+}
+
+// oneLine strips markup and collapses whitespace, so that descriptions fit on
+// a line
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(markup.ReplaceAllString(s, " "))), " ")
+}
+
+// parseDuration reads an itunes:duration, which can be given as seconds, MM:SS
+// or HH:MM:SS. Durations that can't be parsed are 0.
+func parseDuration(s string) int {
+	total := 0
+	for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		total = total*60 + n
+	}
+
+	return total
+}
+
 func ParseElapsed(inSeconds int) string {
 	minutes := inSeconds / 60
 	seconds := inSeconds % 60
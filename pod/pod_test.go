@@ -0,0 +1,194 @@
+package pod
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testItem is an item in a feed served by testServer
+type testItem struct {
+	title, guid, mp3 string
+	day              int // Day of January 2021 it was published
+}
+
+// rssDoc builds an RSS document publishing items
+func rssDoc(items ...testItem) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>Test</title><link>http://example.com</link>`)
+	for _, it := range items {
+		guid := ""
+		if it.guid != "" {
+			guid = "<guid>" + it.guid + "</guid>"
+		}
+		fmt.Fprintf(&b, `<item><title>%s</title>%s<pubDate>%02d Jan 2021 10:00:00 GMT</pubDate><enclosure url="http://example.com/%s" length="100" type="audio/mpeg"/></item>`,
+			it.title, guid, it.day, it.mp3)
+	}
+	b.WriteString(`</channel></rss>`)
+
+	return b.String()
+}
+
+// testServer serves whatever *body holds
+func testServer(t *testing.T, body *string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, *body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func titles(eps Episodes) []string {
+	out := []string{}
+	for _, ep := range eps {
+		out = append(out, ep.Title)
+	}
+
+	return out
+}
+
+func TestFeedUpdate(t *testing.T) {
+	var (
+		one   = testItem{title: "One", guid: "g1", mp3: "1.mp3", day: 1}
+		two   = testItem{title: "Two", guid: "g2", mp3: "2.mp3", day: 2}
+		three = testItem{title: "Three", guid: "g3", mp3: "3.mp3", day: 3}
+	)
+	noGUID := func(it testItem) testItem {
+		it.guid = ""
+		return it
+	}
+	newGUID := func(it testItem) testItem {
+		it.guid = "new-" + it.guid
+		return it
+	}
+
+	tests := []struct {
+		name      string
+		before    []testItem
+		setup     func(f *Feed) // Changes made between updates
+		after     []testItem
+		wantAdded int
+		check     func(t *testing.T, f *Feed)
+	}{
+		{
+			name:   "legacy episodes learn their GUIDs",
+			before: []testItem{noGUID(one), noGUID(two)},
+			setup: func(f *Feed) {
+				f.Episodes[1].MarkPlayed(true)
+				f.Episodes[0].Elapsed = 30
+				f.Playlists = map[string][]int{"mine": {1, 0}}
+			},
+			after: []testItem{one, two},
+			check: func(t *testing.T, f *Feed) {
+				if got := f.Episodes[0]; got.Key() != "g1" || got.Elapsed != 30 {
+					t.Errorf("One = key %s elapsed %d, want g1 and 30", got.Key(), got.Elapsed)
+				}
+				if !f.Episodes[1].Played {
+					t.Error("Two lost its played state")
+				}
+				if got := titles(f.Playlist("mine")); !reflect.DeepEqual(got, []string{"Two", "One"}) {
+					t.Errorf("playlist = %v, want [Two One]", got)
+				}
+			},
+		},
+		{
+			name:   "changed GUIDs are new episodes",
+			before: []testItem{one, two},
+			setup: func(f *Feed) {
+				f.Episodes[0].MarkPlayed(true)
+			},
+			after:     []testItem{newGUID(one), newGUID(two)},
+			wantAdded: 2,
+			check: func(t *testing.T, f *Feed) {
+				if len(f.Episodes) != 4 {
+					t.Fatalf("got %d episodes, want 4", len(f.Episodes))
+				}
+				for _, ep := range f.Episodes {
+					old := !strings.HasPrefix(ep.GUID, "new-")
+					if ep.Removed != old {
+						t.Errorf("%s (%s) removed = %v, want %v", ep.Title, ep.GUID, ep.Removed, old)
+					}
+					if ep.Played != (ep.GUID == "g1") {
+						t.Errorf("%s (%s) played = %v", ep.Title, ep.GUID, ep.Played)
+					}
+				}
+			},
+		},
+		{
+			name:   "back-inserted episodes keep state and playlists in place",
+			before: []testItem{one, three},
+			setup: func(f *Feed) {
+				f.Episodes[1].MarkPlayed(true)
+				f.Playlists = map[string][]int{"mine": {1}}
+			},
+			after:     []testItem{three, two, one},
+			wantAdded: 1,
+			check: func(t *testing.T, f *Feed) {
+				if got := titles(f.Episodes); !reflect.DeepEqual(got, []string{"One", "Two", "Three"}) {
+					t.Fatalf("episodes = %v", got)
+				}
+				if !f.Episodes[2].Played || f.Episodes[1].Played {
+					t.Error("played state moved with the episode IDs")
+				}
+				if got := titles(f.Playlist("mine")); !reflect.DeepEqual(got, []string{"Three"}) {
+					t.Errorf("playlist = %v, want [Three]", got)
+				}
+			},
+		},
+		{
+			name:   "pulled episodes are kept and flagged",
+			before: []testItem{one, two},
+			setup: func(f *Feed) {
+				f.Episodes[1].Elapsed = 60
+			},
+			after: []testItem{one},
+			check: func(t *testing.T, f *Feed) {
+				if len(f.Episodes) != 2 {
+					t.Fatalf("got %d episodes, want 2", len(f.Episodes))
+				}
+				if f.Episodes[0].Removed || !f.Episodes[1].Removed {
+					t.Error("wrong episode flagged as removed")
+				}
+				if f.Episodes[1].Elapsed != 60 {
+					t.Error("removed episode lost its resume point")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				body = rssDoc(tt.before...)
+				srv  = testServer(t, &body)
+				f    = &Feed{RSS: srv.URL}
+				ctx  = context.Background()
+			)
+
+			if _, err := f.Update(ctx, true); err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(f)
+
+			body = rssDoc(tt.after...)
+			added, err := f.Update(ctx, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("added %d episodes, want %d", added, tt.wantAdded)
+			}
+			for i, ep := range f.Episodes {
+				if ep.ID != i {
+					t.Errorf("%s has ID %d at position %d", ep.Title, ep.ID, i)
+				}
+			}
+			tt.check(t, f)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package pod
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Policy controls automatic downloads and clean up of local files for a feed
+type Policy struct {
+	Keep   int `json:"keep,omitempty"`   // Keep the next Keep unplayed episodes downloaded
+	Expire int `json:"expire,omitempty"` // Delete local files Expire days after an episode is played, 0 never does
+}
+
+// String implements the Stringer interface
+func (p Policy) String() string {
+	var (
+		keep   = "none"
+		expire = "never"
+	)
+	if p.Keep > 0 {
+		keep = fmt.Sprintf("next %d unplayed", p.Keep)
+	}
+	if p.Expire > 0 {
+		expire = fmt.Sprintf("%d days after played", p.Expire)
+	}
+
+	return fmt.Sprintf("download %s, delete %s", keep, expire)
+}
+
+// PolicyReport is the outcome of applying download policies
+type PolicyReport struct {
+	Downloads []*Download // Downloads started, check each for errors
+	Deleted   Episodes    // Episodes whose local files were removed
+	Errors    []error     // Files that couldn't be removed
+	Size      int64       // Size of the library afterwards
+}
+
+// ApplyPolicies downloads and deletes local files according to each feed's
+// policy, then deletes played episodes, oldest first, until the library fits
+// within quota bytes. A quota of 0 is unlimited.
+func (store *Store) ApplyPolicies(ctx context.Context, library string, quota int64, workers int) PolicyReport {
+	var (
+		report PolicyReport
+		now    = time.Now()
+	)
+
+	for _, f := range store.Feeds {
+		if f.Policy.Expire > 0 {
+			expiry := now.AddDate(0, 0, -f.Policy.Expire)
+
+			for _, ep := range f.Episodes {
+				if !ep.Played || !ep.Downloaded() {
+					continue
+				}
+
+				// Episodes played before we recorded when start the clock now
+				if ep.PlayedAt.IsZero() {
+					ep.PlayedAt = now
+				}
+				if ep.PlayedAt.Before(expiry) {
+					report.remove(ep)
+				}
+			}
+		}
+
+		if f.Policy.Keep > 0 {
+			n := 0
+			for _, ep := range f.Ordered() {
+				if n == f.Policy.Keep {
+					break
+				}
+				if ep.Played || f.Skipped(ep) {
+					continue
+				}
+
+				n++
+				if !ep.Downloaded() {
+					// Feeds often publish the wrong length, failing would
+					// fetch the whole file again on every update
+					d := NewDownload(library, f, ep)
+					d.Verify = false
+					report.Downloads = append(report.Downloads, d)
+				}
+			}
+		}
+	}
+
+	DownloadAll(ctx, report.Downloads, workers)
+
+	// Find everything in the library, played episodes first and oldest first
+	var (
+		local Episodes
+		sizes = make(map[*Episode]int64)
+	)
+
+	for _, f := range store.Feeds {
+		for _, ep := range f.Episodes {
+			if fi, err := os.Stat(ep.File); ep.File != "" && err == nil {
+				local = append(local, ep)
+				sizes[ep] = fi.Size()
+				report.Size += fi.Size()
+			}
+		}
+	}
+
+	if quota <= 0 || report.Size <= quota {
+		return report
+	}
+
+	sort.SliceStable(local, func(i, j int) bool {
+		if local[i].Played != local[j].Played {
+			return local[i].Played
+		}
+		return local[i].PlayedAt.Before(local[j].PlayedAt)
+	})
+
+	for _, ep := range local {
+		if report.Size <= quota || !ep.Played {
+			break
+		}
+
+		if report.remove(ep) {
+			report.Size -= sizes[ep]
+		}
+	}
+
+	return report
+}
+
+// remove deletes the local copy of an episode
+func (r *PolicyReport) remove(ep *Episode) bool {
+	if err := os.Remove(ep.File); err != nil && !os.IsNotExist(err) {
+		r.Errors = append(r.Errors, err)
+		return false
+	}
+
+	ep.File = ""
+	r.Deleted = append(r.Deleted, ep)
+	return true
+}
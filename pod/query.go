@@ -0,0 +1,214 @@
+package pod
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Query selects episodes for a smart playlist. Smart playlists are evaluated
+// each time they're used so episodes that match after an update are included.
+// Unset fields match everything.
+type Query struct {
+	Title  string    `json:"title,omitempty"`  // RE2 regular expression matched against episode titles
+	Played *bool     `json:"played,omitempty"` // Played state
+	After  time.Time `json:"after,omitempty"`  // Published on or after
+	Before time.Time `json:"before,omitempty"` // Published before
+	Feeds  []string  `json:"feeds,omitempty"`  // RSS urls of the feeds to search
+
+	// Duration bounds in seconds. Episodes of unknown duration never match a
+	// query with bounds.
+	MinDuration int `json:"min_duration,omitempty"`
+	MaxDuration int `json:"max_duration,omitempty"`
+
+	Season   int      `json:"season,omitempty"`   // Season number
+	Types    []string `json:"types,omitempty"`    // Episode types, full, trailer or bonus
+	Explicit *bool    `json:"explicit,omitempty"` // Explicit rating
+}
+
+// Match is an episode selected by a query
+type Match struct {
+	Feed    *Feed
+	Episode *Episode
+}
+
+// Validate checks the query can be run
+func (q *Query) Validate() error {
+	if _, err := q.title(); err != nil {
+		return err
+	}
+	if q.MaxDuration > 0 && q.MaxDuration < q.MinDuration {
+		return fmt.Errorf("maximum duration is less than the minimum")
+	}
+	for _, t := range q.Types {
+		if t != "full" && t != "trailer" && t != "bonus" {
+			return fmt.Errorf("invalid episode type: [%s], use full, trailer or bonus", t)
+		}
+	}
+
+	return nil
+}
+
+// title compiles the query's title filter
+func (q *Query) title() (*regexp.Regexp, error) {
+	r, err := regexp.Compile(q.Title)
+	if err != nil {
+		return nil, fmt.Errorf("invalid title filter: %s", err)
+	}
+
+	return r, nil
+}
+
+// Run the query against feeds. Matches are returned oldest first. Queries
+// saved by hand can be invalid so the title filter is checked here too.
+func (q *Query) Run(feeds Feeds) ([]Match, error) {
+	r, err := q.title()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []Match{}
+
+	for _, f := range feeds {
+		if !q.searches(f) {
+			continue
+		}
+
+		for _, ep := range f.Episodes {
+			if q.matches(r, ep) {
+				out = append(out, Match{Feed: f, Episode: ep})
+			}
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Episode.Published.Before(out[j].Episode.Published)
+	})
+
+	return out, nil
+}
+
+// Episodes of f that match the query
+func (q *Query) Episodes(f *Feed) (Episodes, error) {
+	matches, err := q.Run(Feeds{f})
+	if err != nil {
+		return nil, err
+	}
+
+	out := Episodes{}
+	for _, m := range matches {
+		out = append(out, m.Episode)
+	}
+
+	return out, nil
+}
+
+// searches checks whether episodes of f are included in the query
+func (q *Query) searches(f *Feed) bool {
+	if len(q.Feeds) == 0 {
+		return true
+	}
+
+	for _, rss := range q.Feeds {
+		if rss == f.RSS {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (q *Query) matches(r *regexp.Regexp, ep *Episode) bool {
+	switch {
+	case !r.MatchString(ep.Title):
+		return false
+	case q.Played != nil && ep.Played != *q.Played:
+		return false
+	case !q.After.IsZero() && ep.Published.Before(q.After):
+		return false
+	case !q.Before.IsZero() && !ep.Published.Before(q.Before):
+		return false
+	case (q.MinDuration > 0 || q.MaxDuration > 0) && ep.Duration == 0:
+		return false
+	case q.MinDuration > 0 && ep.Duration < q.MinDuration:
+		return false
+	case q.MaxDuration > 0 && ep.Duration > q.MaxDuration:
+		return false
+	case q.Season > 0 && ep.Season != q.Season:
+		return false
+	case len(q.Types) > 0 && !contains(q.Types, ep.EpisodeType()):
+		return false
+	case q.Explicit != nil && ep.Explicit != *q.Explicit:
+		return false
+	}
+
+	return true
+}
+
+// String implements the Stringer interface
+func (q *Query) String() string {
+	var out []string
+	if q.Title != "" {
+		out = append(out, fmt.Sprintf("title ~ %s", q.Title))
+	}
+	if q.Played != nil {
+		out = append(out, fmt.Sprintf("played = %v", *q.Played))
+	}
+	if !q.After.IsZero() {
+		out = append(out, "after "+q.After.Format("2006-01-02"))
+	}
+	if !q.Before.IsZero() {
+		out = append(out, "before "+q.Before.Format("2006-01-02"))
+	}
+	if q.MinDuration > 0 {
+		out = append(out, "at least "+ParseElapsed(q.MinDuration))
+	}
+	if q.MaxDuration > 0 {
+		out = append(out, "at most "+ParseElapsed(q.MaxDuration))
+	}
+	if q.Season > 0 {
+		out = append(out, fmt.Sprintf("season %d", q.Season))
+	}
+	if len(q.Types) > 0 {
+		out = append(out, "type "+strings.Join(q.Types, "/"))
+	}
+	if q.Explicit != nil {
+		out = append(out, fmt.Sprintf("explicit = %v", *q.Explicit))
+	}
+	if len(q.Feeds) > 0 {
+		out = append(out, fmt.Sprintf("%d feeds", len(q.Feeds)))
+	}
+
+	if len(out) == 0 {
+		return "everything"
+	}
+	return strings.Join(out, ", ")
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SaveSmartPlaylist saves q as the smart playlist name, replacing any with the
+// same name. A nil q deletes the playlist.
+func (store *Store) SaveSmartPlaylist(name string, q *Query) error {
+	if err := store.backend.SaveSmartPlaylist(name, q); err != nil {
+		return err
+	}
+
+	if q == nil {
+		delete(store.Smart, name)
+	} else {
+		store.Smart[name] = q
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package pod
+
+// QueueItem is an episode in the listening queue. Episodes are referenced by
+// the RSS url of their feed and their Key so that the queue survives feeds
+// being reordered and episodes being renumbered.
+type QueueItem struct {
+	Feed    string `json:"feed"`
+	Episode string `json:"episode"`
+}
+
+// Queue of episodes to play, across feeds, in order
+type Queue []QueueItem
+
+// NewQueueItem references ep in feed f
+func NewQueueItem(f *Feed, ep *Episode) QueueItem {
+	return QueueItem{Feed: f.RSS, Episode: ep.Key()}
+}
+
+// Add appends items to the queue, skipping any that are already queued
+func (q Queue) Add(items ...QueueItem) Queue {
+	for _, it := range items {
+		if q.Index(it) < 0 {
+			q = append(q, it)
+		}
+	}
+
+	return q
+}
+
+// Remove items from the queue
+func (q Queue) Remove(items ...QueueItem) Queue {
+	out := Queue{}
+	for _, it := range q {
+		if (Queue(items)).Index(it) < 0 {
+			out = append(out, it)
+		}
+	}
+
+	return out
+}
+
+// Move the item at position from to position to. Positions out of range are
+// clamped to the ends of the queue.
+func (q Queue) Move(from, to int) Queue {
+	if from < 0 || from >= len(q) {
+		return q
+	}
+	if to < 0 {
+		to = 0
+	}
+	if to >= len(q) {
+		to = len(q) - 1
+	}
+
+	out := append(Queue{}, q[:from]...)
+	out = append(out, q[from+1:]...)
+	out = append(out[:to], append(Queue{q[from]}, out[to:]...)...)
+	return out
+}
+
+// Index returns the position of it in the queue, or -1 if it isn't queued
+func (q Queue) Index(it QueueItem) int {
+	for i, qi := range q {
+		if qi == it {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Queued resolves a queue item to its feed and episode. Both are nil if the
+// feed has been deleted or the episode can no longer be found.
+func (store *Store) Queued(it QueueItem) (*Feed, *Episode) {
+	for _, f := range store.Feeds {
+		if f.RSS != it.Feed {
+			continue
+		}
+
+		for _, ep := range f.Episodes {
+			// Episodes queued before their feed published a GUID are keyed by their enclosure
+			if ep.Key() == it.Episode || ep.Mp3 == it.Episode {
+				return f, ep
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// UpdateQueue applies fn to the queue as it currently is in the store, so that
+// changes made by other yapa processes aren't lost, and writes the result
+func (store *Store) UpdateQueue(fn func(Queue) Queue) error {
+	q, err := store.backend.UpdateQueue(fn)
+	if err != nil {
+		return err
+	}
+
+	store.Queue = q
+	return nil
+}
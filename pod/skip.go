@@ -0,0 +1,113 @@
+package pod
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Skip rules pick out episodes of a feed that shouldn't be played in order,
+// like trailers and bonus content sitting in a back catalogue
+type Skip struct {
+	Types []string `json:"types,omitempty"` // Episode types to skip, trailer and/or bonus
+	Title string   `json:"title,omitempty"` // RE2 regular expression matched against episode titles
+	Mark  bool     `json:"mark,omitempty"`  // Mark skipped episodes played rather than leaving them unplayed
+
+	title *regexp.Regexp // Title compiled, set when the rules are loaded or validated
+}
+
+// UnmarshalJSON implements json.Unmarshaler, compiling the title filter as the
+// rules are loaded so Matches never has to
+func (s *Skip) UnmarshalJSON(data []byte) error {
+	type rules Skip // Without the method, so this doesn't recurse
+	if err := json.Unmarshal(data, (*rules)(s)); err != nil {
+		return err
+	}
+
+	// An invalid filter matches nothing, as Matches checks for itself
+	s.title, _ = regexp.Compile(s.Title)
+	return nil
+}
+
+// Validate checks the rules can be used and compiles the title filter
+func (s *Skip) Validate() error {
+	for _, t := range s.Types {
+		if t != "trailer" && t != "bonus" {
+			return fmt.Errorf("invalid episode type: [%s], use trailer or bonus", t)
+		}
+	}
+
+	r, err := regexp.Compile(s.Title)
+	if err != nil {
+		return fmt.Errorf("invalid title filter: %s", err)
+	}
+	s.title = r
+
+	return nil
+}
+
+// Matches checks whether ep should be skipped. It only reads the rules so
+// it's safe to call from more than one goroutine.
+func (s Skip) Matches(ep *Episode) bool {
+	if contains(s.Types, ep.EpisodeType()) {
+		return true
+	}
+	if s.Title == "" {
+		return false
+	}
+
+	r := s.title
+	if r == nil || r.String() != s.Title {
+		// Rules built in code rather than loaded or validated
+		var err error
+		if r, err = regexp.Compile(s.Title); err != nil {
+			return false
+		}
+	}
+
+	return r.MatchString(ep.Title)
+}
+
+// String implements the Stringer interface
+func (s Skip) String() string {
+	var out []string
+	if len(s.Types) > 0 {
+		out = append(out, strings.Join(s.Types, " and ")+" episodes")
+	}
+	if s.Title != "" {
+		out = append(out, "titles matching "+s.Title)
+	}
+	if len(out) == 0 {
+		return "nothing"
+	}
+
+	action := "skip "
+	if s.Mark {
+		action = "mark played "
+	}
+	return action + strings.Join(out, ", ")
+}
+
+// Skipped checks whether ep is left out when the feed is played in order
+func (f *Feed) Skipped(ep *Episode) bool {
+	return f.Skip.Matches(ep)
+}
+
+// MarkSkipped marks unplayed episodes that match the feed's skip rules played,
+// if the rules ask for it, and returns how many were marked
+func (f *Feed) MarkSkipped() int {
+	if !f.Skip.Mark {
+		return 0
+	}
+
+	n := 0
+	for _, ep := range f.Episodes {
+		if !ep.Played && f.Skipped(ep) {
+			ep.MarkPlayed(true)
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,172 @@
+package pod
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Slugify turns a title into a short, lower case name made of letters, digits
+// and dashes. Names made only of digits are prefixed so they can't be mistaken
+// for a feed's position in the store.
+func Slugify(title string) string {
+	var (
+		b    strings.Builder
+		dash bool
+	)
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if r != '\'' {
+			dash = true
+		}
+	}
+
+	slug := b.String()
+	switch {
+	case slug == "":
+		return "feed"
+	case strings.Trim(slug, "0123456789") == "":
+		return "feed-" + slug
+	}
+
+	return slug
+}
+
+// slugFor picks a slug for f that no other feed in the store is using
+func (store *Store) slugFor(f *Feed) string {
+	base := Slugify(f.Title)
+	for n := 1; ; n++ {
+		slug := base
+		if n > 1 {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+
+		taken := false
+		for _, other := range store.Feeds {
+			if other != f && other.Slug == slug {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return slug
+		}
+	}
+}
+
+// assignSlugs gives feeds added before slugs existed one and saves them
+func (store *Store) assignSlugs() error {
+	var changed []*Feed
+	for _, f := range store.Feeds {
+		if f.Slug == "" {
+			f.Slug = store.slugFor(f)
+			changed = append(changed, f)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	return store.SaveFeed(changed...)
+}
+
+// AddFeed gives f a slug and saves it to the store
+func (store *Store) AddFeed(f *Feed) error {
+	f.Slug = store.slugFor(f)
+	store.Feeds = append(store.Feeds, f)
+	return store.SaveFeed(f)
+}
+
+// AmbiguousFeedError is returned by FindFeed when a name matches more than one
+// feed
+type AmbiguousFeedError struct {
+	Name       string
+	Candidates []int // Indexes of the matching feeds
+	feeds      Feeds
+}
+
+// Error implements the error interface
+func (e *AmbiguousFeedError) Error() string {
+	out := fmt.Sprintf("[%s] matches %d feeds, use an ID or slug:", e.Name, len(e.Candidates))
+	for _, i := range e.Candidates {
+		out += fmt.Sprintf("\n  %d\t%s\t%s", i, e.feeds[i].Slug, e.feeds[i].DisplayTitle())
+	}
+
+	return out
+}
+
+// FindFeed resolves name to the index of a feed in the store. name can be the
+// feed's ID, its slug, its title or part of its title, where the title is
+// either the feed's local name or the publisher's. Exact matches win over
+// partial ones and partial matches win over fuzzy ones, where the letters of
+// name only have to appear in the title in order.
+func (store *Store) FindFeed(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return -1, fmt.Errorf("no feed given")
+	}
+
+	if id, err := strconv.Atoi(name); err == nil {
+		if id < 0 || id >= len(store.Feeds) {
+			return -1, fmt.Errorf("no feed with id %d", id)
+		}
+		return id, nil
+	}
+
+	var (
+		lower = strings.ToLower(name)
+		slug  = Slugify(name)
+	)
+	for _, match := range []func(f *Feed, title string) bool{
+		func(f *Feed, title string) bool { return f.Slug == lower },
+		func(f *Feed, title string) bool { return strings.ToLower(title) == lower },
+		func(f *Feed, title string) bool {
+			return strings.Contains(strings.ToLower(title), lower) || strings.Contains(f.Slug, slug)
+		},
+		func(f *Feed, title string) bool { return fuzzy(Slugify(title), slug) },
+	} {
+		var found []int
+		for i, f := range store.Feeds {
+			// Feeds can be found by their local name or the publisher's title
+			if match(f, f.DisplayTitle()) || match(f, f.Title) {
+				found = append(found, i)
+			}
+		}
+
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], nil
+		default:
+			return -1, &AmbiguousFeedError{Name: name, Candidates: found, feeds: store.Feeds}
+		}
+	}
+
+	return -1, fmt.Errorf("no feed matching [%s]", name)
+}
+
+// fuzzy checks whether the letters and digits of pattern appear in s in order
+func fuzzy(s, pattern string) bool {
+	p := []rune(strings.ReplaceAll(pattern, "-", ""))
+	if len(p) == 0 {
+		return false
+	}
+
+	i := 0
+	for _, r := range s {
+		if i < len(p) && r == p[i] {
+			i++
+		}
+	}
+
+	return i == len(p)
+}
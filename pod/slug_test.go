@@ -0,0 +1,126 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Test Show", "test-show"},
+		{"  The Daily!  ", "the-daily"},
+		{"Dan Carlin's Hardcore History", "dan-carlins-hardcore-history"},
+		{"99% Invisible", "99-invisible"},
+		{"Café Società", "café-società"},
+		{"1843", "feed-1843"},
+		{"24/7", "24-7"},
+		{"", "feed"},
+		{"!!!", "feed"},
+	}
+
+	for _, tt := range tests {
+		if got := Slugify(tt.title); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestAddFeedSlugs(t *testing.T) {
+	for _, backend := range []string{"store.json", "store.db"} {
+		t.Run(backend, func(t *testing.T) {
+			var (
+				path  = filepath.Join(t.TempDir(), backend)
+				store = openTestStore(t, path)
+			)
+
+			for i, title := range []string{"Test Show", "Test Show!", "test-show", "Other"} {
+				if err := store.AddFeed(&Feed{Title: title, RSS: fmt.Sprintf("http://example.com/%d", i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Saved by a version of yapa from before slugs
+			if err := store.backend.SaveFeed(&Feed{Title: "Test Show", RSS: "http://example.com/old"}); err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				got  []string
+				want = []string{"test-show", "test-show-2", "test-show-3", "other", "test-show-4"}
+			)
+			for _, f := range openTestStore(t, path).Feeds {
+				got = append(got, f.Slug)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("slugs = %v, want %v", got, want)
+			}
+
+			// Slugs are kept once given, even if the title changes
+			reopened := openTestStore(t, path)
+			reopened.Feeds[0].Title = "Other"
+			if err := reopened.SaveFeed(reopened.Feeds[0]); err != nil {
+				t.Fatal(err)
+			}
+			if got := openTestStore(t, path).Feeds[0].Slug; got != "test-show" {
+				t.Errorf("slug changed to %q after a title change", got)
+			}
+		})
+	}
+}
+
+func TestFindFeed(t *testing.T) {
+	store := &Store{Feeds: Feeds{
+		{Title: "The Daily", Slug: "the-daily"},
+		{Title: "Daily Tech News Show", Name: "Tech", Slug: "daily-tech-news-show"},
+		{Title: "99% Invisible", Slug: "99-invisible"},
+		{Title: "1843", Slug: "feed-1843"},
+		{Title: "The Daily", Slug: "the-daily-2"},
+	}}
+
+	tests := []struct {
+		name          string
+		want          int
+		wantErr       bool
+		wantAmbiguous []int
+	}{
+		{name: "1", want: 1},
+		{name: " 2 ", want: 2},
+		{name: "the-daily-2", want: 4},
+		{name: "Tech", want: 1},
+		{name: "daily tech news show", want: 1},
+		{name: "invisible", want: 2},
+		{name: "feed-1843", want: 3},
+		{name: "dlytch", want: 1},
+		{name: "the daily", wantAmbiguous: []int{0, 4}},
+		{name: "daily", wantAmbiguous: []int{0, 1, 4}},
+		{name: "1843", wantErr: true},
+		{name: "-1", wantErr: true},
+		{name: "nothing", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.FindFeed(tt.name)
+
+			var amb *AmbiguousFeedError
+			switch {
+			case tt.wantAmbiguous != nil:
+				if !errors.As(err, &amb) || !reflect.DeepEqual(amb.Candidates, tt.wantAmbiguous) {
+					t.Errorf("FindFeed(%q) = %d, %v, want candidates %v", tt.name, got, err, tt.wantAmbiguous)
+				}
+			case tt.wantErr:
+				if err == nil || errors.As(err, &amb) {
+					t.Errorf("FindFeed(%q) = %d, %v, want no match", tt.name, got, err)
+				}
+			case err != nil || got != tt.want:
+				t.Errorf("FindFeed(%q) = %d, %v, want %d", tt.name, got, err, tt.want)
+			}
+		})
+	}
+}
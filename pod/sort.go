@@ -0,0 +1,132 @@
+package pod
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortFields are the fields episodes can be sorted by
+var SortFields = []string{"published", "title", "duration", "number", "played"}
+
+// Orders a feed's episodes can be listed and played in. Auto orders serial
+// feeds by number and everything else oldest first.
+var Orders = []string{"auto", "oldest", "newest", "number"}
+
+// ValidOrder checks order is one of Orders
+func ValidOrder(order string) error {
+	for _, o := range Orders {
+		if o == order {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid order: [%s], use one of %s", order, strings.Join(Orders, ", "))
+}
+
+// EffectiveOrder resolves the feed's order, working out what auto means for it
+func (f *Feed) EffectiveOrder() string {
+	switch {
+	case f.Order != "" && f.Order != "auto":
+		return f.Order
+	case f.Type == "serial":
+		return "number"
+	}
+
+	return "oldest"
+}
+
+// Ordered returns the feed's episodes in the order they should be listed and
+// played. Episode IDs are unaffected.
+func (f *Feed) Ordered() Episodes {
+	var out Episodes
+	switch f.EffectiveOrder() {
+	case "number":
+		out, _ = f.Episodes.SortBy("number", false)
+	case "newest":
+		out, _ = f.Episodes.SortBy("published", true)
+	default:
+		out, _ = f.Episodes.SortBy("published", false)
+	}
+
+	return out
+}
+
+// episodeLess returns a comparison of episodes by field. Episodes are sorted by
+// season and then episode number for "number" and by when they were played for
+// "played". Ties are broken by publish date and then by number, for feeds that
+// publish several episodes at once.
+func episodeLess(field string) (func(a, b *Episode) bool, error) {
+	var less func(a, b *Episode) bool
+	switch field {
+	case "", "published":
+		less = func(a, b *Episode) bool { return false }
+	case "title":
+		less = func(a, b *Episode) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case "duration":
+		less = func(a, b *Episode) bool { return a.Duration < b.Duration }
+	case "number":
+		less = func(a, b *Episode) bool {
+			if a.Season != b.Season {
+				return a.Season < b.Season
+			}
+			return a.Number < b.Number
+		}
+	case "played":
+		less = func(a, b *Episode) bool { return a.PlayedAt.Before(b.PlayedAt) }
+	default:
+		return nil, fmt.Errorf("invalid sort: [%s], use one of %s", field, strings.Join(SortFields, ", "))
+	}
+
+	return func(a, b *Episode) bool {
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		if !a.Published.Equal(b.Published) {
+			return a.Published.Before(b.Published)
+		}
+		if a.Season != b.Season {
+			return a.Season < b.Season
+		}
+		return a.Number < b.Number
+	}, nil
+}
+
+// SortBy returns a copy of the episodes sorted by one of SortFields. The
+// episodes themselves, and their IDs, are left alone.
+func (e Episodes) SortBy(field string, reverse bool) (Episodes, error) {
+	less, err := episodeLess(field)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append(Episodes{}, e...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if reverse {
+			return less(out[j], out[i])
+		}
+		return less(out[i], out[j])
+	})
+
+	return out, nil
+}
+
+// SortMatches sorts matches by one of SortFields
+func SortMatches(m []Match, field string, reverse bool) error {
+	less, err := episodeLess(field)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(m, func(i, j int) bool {
+		if reverse {
+			return less(m[j].Episode, m[i].Episode)
+		}
+		return less(m[i].Episode, m[j].Episode)
+	})
+
+	return nil
+}
@@ -0,0 +1,647 @@
+package pod
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver
+)
+
+// sqliteBackend keeps the store in an SQLite database and only writes the rows
+// that have changed. Feeds and episodes are stored as JSON with the frequently
+// written playback state in their own columns so that marking an episode played
+// only touches a single row.
+type sqliteBackend struct {
+	db   *sql.DB
+	path string
+	keep int
+
+	// Backups are taken once per process, before the first write
+	backedUp bool
+
+	// The feeds as they were when this process last read or wrote them, used
+	// to work out which rows need writing
+	base map[string]*Feed
+}
+
+func openSQLite(path string, backups int) (*sqliteBackend, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqliteBackend{db: db, path: path, keep: backups, base: make(map[string]*Feed)}
+
+	// Always keep a copy of the old version before migrating, even if backups are turned off
+	err = upgradeSQLite(db, func() error {
+		keep := backups
+		if keep < 1 {
+			keep = 1
+		}
+		return backup(path, keep, s.snapshot)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Load implements Backend
+func (s *sqliteBackend) Load() (Feeds, error) {
+	var (
+		feeds = Feeds{}
+		byRSS = make(map[string]*Feed)
+	)
+
+	// Feeds keep their rowid when they're saved again, so this is the order
+	// they were added in
+	rows, err := s.db.Query(`SELECT data FROM feeds ORDER BY rowid`)
+	if err != nil {
+		return feeds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return feeds, err
+		}
+
+		f := &Feed{}
+		if err := json.Unmarshal([]byte(data), f); err != nil {
+			return feeds, err
+		}
+		feeds = append(feeds, f)
+		byRSS[f.RSS] = f
+	}
+	if err := rows.Err(); err != nil {
+		return feeds, err
+	}
+
+	// Episodes that sort equally keep the order they were added in, so their
+	// IDs don't change between loads
+	eps, err := s.db.Query(`SELECT feed, data, played, elapsed FROM episodes ORDER BY rowid`)
+	if err != nil {
+		return feeds, err
+	}
+	defer eps.Close()
+
+	for eps.Next() {
+		var (
+			rss, data string
+			ep        = &Episode{}
+		)
+		if err := eps.Scan(&rss, &data, &ep.Played, &ep.Elapsed); err != nil {
+			return feeds, err
+		}
+
+		// The state columns are authoritative, so decode around them
+		played, elapsed := ep.Played, ep.Elapsed
+		if err := json.Unmarshal([]byte(data), ep); err != nil {
+			return feeds, err
+		}
+		ep.Played, ep.Elapsed = played, elapsed
+
+		if f, ok := byRSS[rss]; ok {
+			f.Episodes = append(f.Episodes, ep)
+		}
+	}
+	if err := eps.Err(); err != nil {
+		return feeds, err
+	}
+
+	for _, f := range feeds {
+		sort.Stable(f.Episodes)
+		f.Episodes.setIDs()
+
+		if f.Playlists, err = s.Playlists(f); err != nil {
+			return feeds, err
+		}
+
+		s.base[f.RSS] = f.clone()
+	}
+
+	return feeds, nil
+}
+
+// SaveFeed implements Backend. Only the feed data, episodes and playlists that
+// differ from what this process last read or wrote are written. With the store
+// locked, rows are re-read and only the fields this process changed are
+// applied on top, as the JSON backend does.
+func (s *sqliteBackend) SaveFeed(feeds ...*Feed) error {
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.backup(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, f := range feeds {
+		b, ok := s.base[f.RSS]
+		if !ok {
+			b = &Feed{}
+		}
+
+		var onDisk string
+		err := tx.QueryRow(`SELECT data FROM feeds WHERE rss = ?`, f.RSS).Scan(&onDisk)
+		switch {
+		case err == sql.ErrNoRows && ok:
+			// Deleted by another process
+			continue
+		case err != nil && err != sql.ErrNoRows:
+			return err
+		}
+
+		if h, bh := f.header(), b.header(); !reflect.DeepEqual(h, bh) {
+			if onDisk != "" {
+				d := &Feed{}
+				if err := json.Unmarshal([]byte(onDisk), d); err != nil {
+					return err
+				}
+				if err := patch(&h, d, &bh, f.header(), "playlists"); err != nil {
+					return err
+				}
+			}
+
+			data, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO feeds (rss, data) VALUES (?, ?)
+				ON CONFLICT (rss) DO UPDATE SET data = excluded.data`, f.RSS, string(data)); err != nil {
+				return err
+			}
+		}
+
+		var (
+			inBase = b.Episodes.byKey()
+			inMine = f.Episodes.byKey()
+		)
+
+		for _, ep := range f.Episodes {
+			be := inBase[ep.Key()]
+			if reflect.DeepEqual(ep, be) {
+				continue
+			}
+
+			ne, err := mergeEpisodeRow(tx, f, be, ep)
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(ne)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO episodes (feed, key, data, played, elapsed) VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT (feed, key) DO UPDATE SET data = excluded.data, played = excluded.played, elapsed = excluded.elapsed`,
+				f.RSS, ep.Key(), string(data), ne.Played, ne.Elapsed); err != nil {
+				return err
+			}
+		}
+
+		// Episodes whose key we changed, i.e. a GUID has been found for them
+		for k := range inBase {
+			if _, ok := inMine[k]; !ok {
+				if _, err := tx.Exec(`DELETE FROM episodes WHERE feed = ? AND key = ?`, f.RSS, k); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !reflect.DeepEqual(f.playlistKeys(), b.playlistKeys()) {
+			if _, err := tx.Exec(`DELETE FROM playlists WHERE feed = ?`, f.RSS); err != nil {
+				return err
+			}
+
+			for name, keys := range f.playlistKeys() {
+				data, err := json.Marshal(keys)
+				if err != nil {
+					return err
+				}
+				if _, err := tx.Exec(`INSERT INTO playlists (feed, name, episodes) VALUES (?, ?, ?)`, f.RSS, name, string(data)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, f := range feeds {
+		s.base[f.RSS] = f.clone()
+	}
+
+	return nil
+}
+
+// SaveEpisode implements Backend. The playback state columns are written
+// along with the rest of the episode, so when it was played and anything
+// fetched for it, like its local file or chapters, is kept too.
+func (s *sqliteBackend) SaveEpisode(f *Feed, eps ...*Episode) error {
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.backup(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	inBase := make(map[string]*Episode)
+	if b, ok := s.base[f.RSS]; ok {
+		inBase = b.Episodes.byKey()
+	}
+
+	for _, ep := range eps {
+		ne, err := mergeEpisodeRow(tx, f, inBase[ep.Key()], ep)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(ne)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE episodes SET data = ?, played = ?, elapsed = ? WHERE feed = ? AND key = ?`,
+			string(data), ne.Played, ne.Elapsed, f.RSS, ep.Key()); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Our copies are now what we last wrote
+	for _, ep := range eps {
+		if be, ok := inBase[ep.Key()]; ok {
+			data, err := json.Marshal(ep)
+			if err != nil {
+				return err
+			}
+			*be = Episode{}
+			if err := json.Unmarshal(data, be); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteFeed implements Backend
+func (s *sqliteBackend) DeleteFeed(f *Feed) error {
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.backup(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		`DELETE FROM queue WHERE feed = ?`,
+		`DELETE FROM playlists WHERE feed = ?`,
+		`DELETE FROM episodes WHERE feed = ?`,
+		`DELETE FROM feeds WHERE rss = ?`,
+	} {
+		if _, err := tx.Exec(q, f.RSS); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	delete(s.base, f.RSS)
+	return nil
+}
+
+// Playlists implements Backend
+func (s *sqliteBackend) Playlists(f *Feed) (map[string][]int, error) {
+	rows, err := s.db.Query(`SELECT name, episodes FROM playlists WHERE feed = ?`, f.RSS)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := make(map[string][]string)
+	for rows.Next() {
+		var (
+			name, data string
+			keys       []string
+		)
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &keys); err != nil {
+			return nil, err
+		}
+		lists[name] = keys
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := &Feed{Episodes: f.Episodes}
+	out.setPlaylists(lists)
+	return out.Playlists, nil
+}
+
+// Queue implements Backend
+func (s *sqliteBackend) Queue() (Queue, error) {
+	return readQueue(s.db)
+}
+
+// UpdateQueue implements Backend
+func (s *sqliteBackend) UpdateQueue(fn func(Queue) Queue) (Queue, error) {
+	unlock, err := lock(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := s.backup(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q, err := readQueue(tx)
+	if err != nil {
+		return nil, err
+	}
+	q = fn(q)
+
+	if _, err := tx.Exec(`DELETE FROM queue`); err != nil {
+		return nil, err
+	}
+	for i, it := range q {
+		if _, err := tx.Exec(`INSERT INTO queue (pos, feed, episode) VALUES (?, ?, ?)`, i, it.Feed, it.Episode); err != nil {
+			return nil, err
+		}
+	}
+
+	return q, tx.Commit()
+}
+
+// SmartPlaylists implements Backend
+func (s *sqliteBackend) SmartPlaylists() (map[string]*Query, error) {
+	rows, err := s.db.Query(`SELECT name, query FROM smart_playlists`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]*Query)
+	for rows.Next() {
+		var (
+			name, data string
+			q          = &Query{}
+		)
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), q); err != nil {
+			return nil, err
+		}
+		out[name] = q
+	}
+
+	return out, rows.Err()
+}
+
+// SaveSmartPlaylist implements Backend
+func (s *sqliteBackend) SaveSmartPlaylist(name string, q *Query) error {
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.backup(); err != nil {
+		return err
+	}
+
+	if q == nil {
+		_, err := s.db.Exec(`DELETE FROM smart_playlists WHERE name = ?`, name)
+		return err
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO smart_playlists (name, query) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET query = excluded.query`, name, string(data))
+	return err
+}
+
+// Backups implements Backend
+func (s *sqliteBackend) Backups() ([]string, error) {
+	return Backups(s.path)
+}
+
+// sqliteTables holds everything in the store, restores replace all of them
+var sqliteTables = []string{"feeds", "episodes", "playlists", "queue", "smart_playlists"}
+
+// Restore implements Backend. The backup is copied into the database rather
+// than replacing the file, which other yapa processes may have open.
+func (s *sqliteBackend) Restore(backupPath string) error {
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+		return fmt.Errorf("invalid backup %s: not an SQLite database", backupPath)
+	}
+
+	// Bring a copy of the backup up to date, which also makes sure it's a
+	// readable store, before we replace anything
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+"-restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", tmp.Name())
+	if err != nil {
+		return err
+	}
+	err = upgradeSQLite(db, func() error { return nil })
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("invalid backup %s: %s", backupPath, err)
+	}
+
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := backup(s.path, s.keep, s.snapshot); err != nil {
+		return err
+	}
+
+	// ATTACH applies to a single connection and can't be run in a transaction
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS restore`, tmp.Name()); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `DETACH DATABASE restore`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range sqliteTables {
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM main.%s`, t)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO main.%[1]s SELECT * FROM restore.%[1]s`, t)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.base = make(map[string]*Feed)
+	s.backedUp = true
+	return nil
+}
+
+// Close implements Backend
+func (s *sqliteBackend) Close() error {
+	return s.db.Close()
+}
+
+// mergeEpisodeRow applies the changes made to mine since base onto the
+// episode's row as it is in the store, if it has one
+func mergeEpisodeRow(tx *sql.Tx, f *Feed, base, mine *Episode) (*Episode, error) {
+	var (
+		data string
+		de   = &Episode{}
+	)
+	err := tx.QueryRow(`SELECT data, played, elapsed FROM episodes WHERE feed = ? AND key = ?`,
+		f.RSS, mine.Key()).Scan(&data, &de.Played, &de.Elapsed)
+	if err == sql.ErrNoRows {
+		return mine, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	played, elapsed := de.Played, de.Elapsed
+	if err := json.Unmarshal([]byte(data), de); err != nil {
+		return nil, err
+	}
+	de.Played, de.Elapsed = played, elapsed
+
+	if base == nil {
+		base = &Episode{}
+	}
+
+	ne := &Episode{}
+	if err := patch(ne, de, base, mine, "id"); err != nil {
+		return nil, err
+	}
+	ne.ID = mine.ID
+
+	return ne, nil
+}
+
+// readQueue reads the queue in order with db, which may be a transaction
+func readQueue(db interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}) (Queue, error) {
+	rows, err := db.Query(`SELECT feed, episode FROM queue ORDER BY pos`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	q := Queue{}
+	for rows.Next() {
+		var it QueueItem
+		if err := rows.Scan(&it.Feed, &it.Episode); err != nil {
+			return nil, err
+		}
+		q = append(q, it)
+	}
+
+	return q, rows.Err()
+}
+
+// backup takes a backup of the database before this process first writes to it
+func (s *sqliteBackend) backup() error {
+	if s.backedUp {
+		return nil
+	}
+	s.backedUp = true
+
+	return backup(s.path, s.keep, s.snapshot)
+}
+
+// snapshot writes a consistent copy of the database to dst
+func (s *sqliteBackend) snapshot(dst string) error {
+	_, err := s.db.Exec(`VACUUM INTO ?`, dst)
+	return err
+}
@@ -0,0 +1,261 @@
+package pod
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ErrorInvalidPath       = "cannot read or create store at given path"
+	ErrorStoreDoesNotExist = "no existing store found"
+)
+
+// Backend persists the store. Implementations only write the changes made by
+// this process so that concurrent yapa processes don't clobber each other.
+type Backend interface {
+	// Load reads every feed in the store
+	Load() (Feeds, error)
+	// SaveFeed writes feed data, episodes and playlists
+	SaveFeed(feeds ...*Feed) error
+	// SaveEpisode writes episodes of a feed, typically after their playback state changes
+	SaveEpisode(f *Feed, eps ...*Episode) error
+	// DeleteFeed removes a feed and its episodes from the store
+	DeleteFeed(f *Feed) error
+	// Playlists reads the saved playlists for a feed
+	Playlists(f *Feed) (map[string][]int, error)
+	// Queue reads the listening queue
+	Queue() (Queue, error)
+	// UpdateQueue replaces the queue with the result of fn, which is passed the
+	// queue as it is in the store, and returns the new queue
+	UpdateQueue(fn func(Queue) Queue) (Queue, error)
+	// SmartPlaylists reads the saved smart playlist queries
+	SmartPlaylists() (map[string]*Query, error)
+	// SaveSmartPlaylist writes a smart playlist, or deletes it if q is nil
+	SaveSmartPlaylist(name string, q *Query) error
+	// Backups lists backups of the store, newest first
+	Backups() ([]string, error)
+	// Restore replaces the store with a backup
+	Restore(backup string) error
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// Store is the feed collection, we load it on open and write it on changes
+type Store struct {
+	Path  string
+	Feeds Feeds             `json:"feeds"`
+	Queue Queue             `json:"queue"`
+	Smart map[string]*Query `json:"smart_playlists"`
+
+	backend Backend
+}
+
+// Open the backend for the store at path. Paths ending in .db, .sqlite or
+// .sqlite3 are SQLite databases, anything else is a JSON file. backups is the
+// number of backups of previous versions of the store to keep.
+func Open(path string, backups int) (Backend, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return openSQLite(path, backups)
+	default:
+		return openJSON(path, backups)
+	}
+}
+
+// ReadStore opens and reads the store at path
+func ReadStore(path string, backups int) (*Store, error) {
+	store := &Store{
+		// Replace ~/ with home dir
+		Path:  expandHome(path),
+		Feeds: Feeds{},
+		Queue: Queue{},
+		Smart: make(map[string]*Query),
+	}
+
+	// Validate dirpath
+	dir := filepath.Dir(store.Path)
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return nil, fmt.Errorf(ErrorInvalidPath)
+	}
+
+	_, statErr := os.Stat(store.Path)
+
+	var err error
+	if store.backend, err = Open(store.Path, backups); err != nil {
+		return nil, err
+	}
+
+	if os.IsNotExist(statErr) {
+		// Return an empty store if none exists
+		return store, fmt.Errorf(ErrorStoreDoesNotExist)
+	}
+
+	if store.Feeds, err = store.backend.Load(); err != nil {
+		return store, err
+	}
+
+	if store.Queue, err = store.backend.Queue(); err != nil {
+		return store, err
+	}
+
+	if store.Smart, err = store.backend.SmartPlaylists(); err != nil {
+		return store, err
+	}
+
+	return store, store.assignSlugs()
+}
+
+// WriteStore writes every feed in the store
+func WriteStore(store *Store) error {
+	return store.backend.SaveFeed(store.Feeds...)
+}
+
+// SaveFeed writes the given feeds to the store
+func (store *Store) SaveFeed(feeds ...*Feed) error {
+	return store.backend.SaveFeed(feeds...)
+}
+
+// SaveEpisode writes an episode, typically after its playback state changes, to the store
+func (store *Store) SaveEpisode(f *Feed, ep *Episode) error {
+	return store.backend.SaveEpisode(f, ep)
+}
+
+// DeleteFeed removes the feed at index i, and any of its episodes that are
+// queued, from the store
+func (store *Store) DeleteFeed(i int) error {
+	if err := store.backend.DeleteFeed(store.Feeds[i]); err != nil {
+		return err
+	}
+
+	q := Queue{}
+	for _, it := range store.Queue {
+		if it.Feed != store.Feeds[i].RSS {
+			q = append(q, it)
+		}
+	}
+	store.Queue = q
+
+	store.Feeds = append(store.Feeds[:i], store.Feeds[i+1:]...)
+	return nil
+}
+
+// Backups lists backups of the store, newest first
+func (store *Store) Backups() ([]string, error) {
+	return store.backend.Backups()
+}
+
+// Restore replaces the store with the given backup. The current store is backed
+// up first so a restore can itself be undone.
+func (store *Store) Restore(backup string) error {
+	if err := store.backend.Restore(backup); err != nil {
+		return err
+	}
+
+	feeds, err := store.backend.Load()
+	if err != nil {
+		return err
+	}
+
+	queue, err := store.backend.Queue()
+	if err != nil {
+		return err
+	}
+
+	smart, err := store.backend.SmartPlaylists()
+	if err != nil {
+		return err
+	}
+
+	store.Feeds, store.Queue, store.Smart = feeds, queue, smart
+	return store.assignSlugs()
+}
+
+// Close the store
+func (store *Store) Close() error {
+	return store.backend.Close()
+}
+
+// Migrate copies every feed, the queue and smart playlists in the store to a new store at path, which can use
+// a different backend. path must not already exist.
+func (store *Store) Migrate(path string, backups int) error {
+	path = expandHome(path)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	dst, err := Open(path, backups)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if err := dst.SaveFeed(store.Feeds...); err != nil {
+		return err
+	}
+
+	for name, q := range store.Smart {
+		if err := dst.SaveSmartPlaylist(name, q); err != nil {
+			return err
+		}
+	}
+
+	_, err = dst.UpdateQueue(func(Queue) Queue { return store.Queue })
+	return err
+}
+
+// Subscribed checks for an existing feed with the given RSS url
+func (store *Store) Subscribed(rss string) bool {
+	for _, f := range store.Feeds {
+		if f.RSS == rss {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	return strings.Replace(path, "~/", os.Getenv("HOME")+"/", 1)
+}
+
+// clone makes a deep copy of a feed
+func (f *Feed) clone() *Feed {
+	out := &Feed{}
+	data, err := json.Marshal(f)
+	if err == nil {
+		json.Unmarshal(data, out)
+	}
+
+	return out
+}
+
+// header returns a copy of the feed without its episodes or playlists
+func (f *Feed) header() Feed {
+	h := *f
+	h.Episodes, h.Playlists = nil, nil
+	return h
+}
+
+// byRSS indexes feeds by their RSS url
+func (f Feeds) byRSS() map[string]*Feed {
+	out := make(map[string]*Feed)
+	for _, fd := range f {
+		out[fd.RSS] = fd
+	}
+
+	return out
+}
+
+// byKey indexes episodes by their Key
+func (e Episodes) byKey() map[string]*Episode {
+	out := make(map[string]*Episode)
+	for _, ep := range e {
+		out[ep.Key()] = ep
+	}
+
+	return out
+}
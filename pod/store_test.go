@@ -0,0 +1,183 @@
+package pod
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openTestStore opens the store at path, which may not exist yet
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+
+	store, err := ReadStore(path, 0)
+	if err != nil && err.Error() != ErrorStoreDoesNotExist {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// testFeed is a feed with two episodes, as if it had just been added
+func testFeed() *Feed {
+	day := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	return &Feed{
+		Title: "Test Show",
+		RSS:   "http://example.com/rss",
+		Episodes: Episodes{
+			{ID: 0, GUID: "g1", Title: "One", Mp3: "http://example.com/1.mp3", Published: day},
+			{ID: 1, GUID: "g2", Title: "Two", Mp3: "http://example.com/2.mp3", Published: day.AddDate(0, 0, 1)},
+		},
+		Playlists: map[string][]int{},
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  func(s *Store) error // Edits made by two processes, a saves first
+		check func(t *testing.T, f *Feed)
+	}{
+		{
+			name: "different episodes",
+			a: func(s *Store) error {
+				f := s.Feeds[0]
+				f.Episodes[0].MarkPlayed(true)
+				return s.SaveEpisode(f, f.Episodes[0])
+			},
+			b: func(s *Store) error {
+				f := s.Feeds[0]
+				f.Episodes[1].Elapsed = 90
+				return s.SaveEpisode(f, f.Episodes[1])
+			},
+			check: func(t *testing.T, f *Feed) {
+				if !f.Episodes[0].Played || f.Episodes[1].Elapsed != 90 {
+					t.Errorf("lost an edit: played %v, elapsed %d", f.Episodes[0].Played, f.Episodes[1].Elapsed)
+				}
+			},
+		},
+		{
+			name: "different fields of one episode",
+			a: func(s *Store) error {
+				f := s.Feeds[0]
+				f.Episodes[0].Elapsed = 45
+				return s.SaveEpisode(f, f.Episodes[0])
+			},
+			b: func(s *Store) error {
+				f := s.Feeds[0]
+				f.Episodes[0].File = "/tmp/1.mp3"
+				return s.SaveFeed(f)
+			},
+			check: func(t *testing.T, f *Feed) {
+				if ep := f.Episodes[0]; ep.Elapsed != 45 || ep.File != "/tmp/1.mp3" {
+					t.Errorf("lost an edit: elapsed %d, file %q", ep.Elapsed, ep.File)
+				}
+			},
+		},
+		{
+			name: "conflicting episode edits",
+			a: func(s *Store) error {
+				f := s.Feeds[0]
+				f.Episodes[0].Elapsed = 10
+				return s.SaveEpisode(f, f.Episodes[0])
+			},
+			b: func(s *Store) error {
+				f := s.Feeds[0]
+				f.Episodes[0].Elapsed = 20
+				return s.SaveEpisode(f, f.Episodes[0])
+			},
+			check: func(t *testing.T, f *Feed) {
+				if got := f.Episodes[0].Elapsed; got != 20 {
+					t.Errorf("elapsed = %d, want the last write 20", got)
+				}
+			},
+		},
+		{
+			name: "different feed fields",
+			a: func(s *Store) error {
+				s.Feeds[0].Name = "Mine"
+				return s.SaveFeed(s.Feeds[0])
+			},
+			b: func(s *Store) error {
+				s.Feeds[0].Tags = []string{"news"}
+				return s.SaveFeed(s.Feeds[0])
+			},
+			check: func(t *testing.T, f *Feed) {
+				if f.Name != "Mine" || !reflect.DeepEqual(f.Tags, []string{"news"}) {
+					t.Errorf("lost an edit: name %q, tags %v", f.Name, f.Tags)
+				}
+			},
+		},
+		{
+			name: "conflicting feed edits",
+			a: func(s *Store) error {
+				s.Feeds[0].Name = "First"
+				return s.SaveFeed(s.Feeds[0])
+			},
+			b: func(s *Store) error {
+				s.Feeds[0].Name = "Second"
+				return s.SaveFeed(s.Feeds[0])
+			},
+			check: func(t *testing.T, f *Feed) {
+				if f.Name != "Second" {
+					t.Errorf("name = %q, want the last write Second", f.Name)
+				}
+			},
+		},
+		{
+			name: "new episode and a played flag",
+			a: func(s *Store) error {
+				f := s.Feeds[0]
+				f.Episodes = append(f.Episodes, &Episode{
+					ID: 2, GUID: "g3", Title: "Three", Mp3: "http://example.com/3.mp3",
+					Published: f.Episodes[1].Published.AddDate(0, 0, 1),
+				})
+				return s.SaveFeed(f)
+			},
+			b: func(s *Store) error {
+				f := s.Feeds[0]
+				f.Episodes[1].MarkPlayed(true)
+				f.Playlists = map[string][]int{"later": {1}}
+				return s.SaveFeed(f)
+			},
+			check: func(t *testing.T, f *Feed) {
+				if got := titles(f.Episodes); !reflect.DeepEqual(got, []string{"One", "Two", "Three"}) {
+					t.Fatalf("episodes = %v", got)
+				}
+				if !f.Episodes[1].Played {
+					t.Error("lost the played flag")
+				}
+				if got := titles(f.Playlist("later")); !reflect.DeepEqual(got, []string{"Two"}) {
+					t.Errorf("playlist = %v, want [Two]", got)
+				}
+			},
+		},
+	}
+
+	for _, backend := range []string{"store.json", "store.db"} {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), backend)
+				if err := openTestStore(t, path).AddFeed(testFeed()); err != nil {
+					t.Fatal(err)
+				}
+
+				a, b := openTestStore(t, path), openTestStore(t, path)
+				if err := tt.a(a); err != nil {
+					t.Fatal(err)
+				}
+				if err := tt.b(b); err != nil {
+					t.Fatal(err)
+				}
+
+				got := openTestStore(t, path)
+				if len(got.Feeds) != 1 {
+					t.Fatalf("got %d feeds, want 1", len(got.Feeds))
+				}
+				tt.check(t, got.Feeds[0])
+			})
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package pod
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Transcript formats, in order of preference. Only the first three have
+// timestamps.
+const (
+	TranscriptJSON = "json"
+	TranscriptVTT  = "vtt"
+	TranscriptSRT  = "srt"
+	TranscriptHTML = "html"
+)
+
+var transcriptFormats = []string{TranscriptJSON, TranscriptVTT, TranscriptSRT, TranscriptHTML}
+
+// Transcript published for an episode
+type Transcript struct {
+	URL      string `json:"url"`
+	Format   string `json:"format"` // One of the Transcript* formats
+	Language string `json:"language,omitempty"`
+}
+
+// Cue is a line of a transcript
+type Cue struct {
+	Start float64 `json:"start"` // Seconds into the episode, 0 for untimed transcripts
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Cues of a transcript, in order
+type Cues []Cue
+
+// At returns the text being spoken at pos seconds, if any
+func (c Cues) At(pos float64) string {
+	i := sort.Search(len(c), func(i int) bool { return c[i].Start > pos }) - 1
+	if i < 0 || pos >= c[i].End {
+		return ""
+	}
+
+	return c[i].Text
+}
+
+// Timed checks whether the cues have timestamps
+func (c Cues) Timed() bool {
+	for _, cue := range c {
+		if cue.End > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// transcripts finds the podcast:transcript links published for an item
+func transcripts(item *gofeed.Item) []Transcript {
+	var out []Transcript
+	for _, ext := range item.Extensions["podcast"]["transcript"] {
+		if format := transcriptFormat(ext.Attrs["type"]); ext.Attrs["url"] != "" && format != "" {
+			out = append(out, Transcript{URL: ext.Attrs["url"], Format: format, Language: ext.Attrs["language"]})
+		}
+	}
+
+	return out
+}
+
+// transcriptFormat maps a transcript's mime type to its format
+func transcriptFormat(mime string) string {
+	switch {
+	case strings.Contains(mime, "json"):
+		return TranscriptJSON
+	case strings.Contains(mime, "vtt"):
+		return TranscriptVTT
+	case strings.Contains(mime, "srt"), strings.Contains(mime, "subrip"):
+		return TranscriptSRT
+	case strings.Contains(mime, "html"):
+		return TranscriptHTML
+	}
+
+	return ""
+}
+
+// Transcript picks the episode's most useful transcript, preferring those
+// with timestamps. ok is false if the episode doesn't have one.
+func (e *Episode) Transcript() (t Transcript, ok bool) {
+	for _, format := range transcriptFormats {
+		for _, t := range e.Transcripts {
+			if t.Format == format {
+				return t, true
+			}
+		}
+	}
+
+	return Transcript{}, false
+}
+
+// Cached checks whether the transcript has been fetched to dir
+func (t Transcript) Cached(dir string) bool {
+	_, err := os.Stat(t.cachePath(dir))
+	return err == nil
+}
+
+// Cues loads the transcript from dir, fetching and caching it if it hasn't
+// been already
+func (t Transcript) Cues(ctx context.Context, dir string) (Cues, error) {
+	path := t.cachePath(dir)
+	if data, err := os.ReadFile(path); err == nil {
+		var c Cues
+		if err := json.Unmarshal(data, &c); err == nil {
+			return c, nil
+		}
+	}
+
+	c, err := fetchTranscript(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	return c, writeFile(path, data)
+}
+
+// cachePath of the parsed transcript. Cues are cached rather than the
+// original so every format is searched the same way.
+func (t Transcript) cachePath(dir string) string {
+	return filepath.Join(expandHome(dir), fmt.Sprintf("%x.json", sha1.Sum([]byte(t.URL))))
+}
+
+func fetchTranscript(ctx context.Context, t Transcript) (Cues, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("transcript: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Format {
+	case TranscriptJSON:
+		return parseJSONTranscript(data)
+	case TranscriptVTT, TranscriptSRT:
+		return parseSubtitles(string(data)), nil
+	default:
+		return parseHTMLTranscript(string(data)), nil
+	}
+}
+
+// jsonTranscript is the podcast namespace transcript format
+type jsonTranscript struct {
+	Segments []struct {
+		Speaker   string  `json:"speaker"`
+		StartTime float64 `json:"startTime"`
+		EndTime   float64 `json:"endTime"`
+		Body      string  `json:"body"`
+	} `json:"segments"`
+}
+
+func parseJSONTranscript(data []byte) (Cues, error) {
+	var doc jsonTranscript
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("transcript: %s", err)
+	}
+
+	out := Cues{}
+	for _, s := range doc.Segments {
+		text := strings.TrimSpace(s.Body)
+		if s.Speaker != "" {
+			text = s.Speaker + ": " + text
+		}
+		out = append(out, Cue{Start: s.StartTime, End: s.EndTime, Text: text})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out, nil
+}
+
+var (
+	cueTiming = regexp.MustCompile(`^((?:\d+:)?\d+:\d+[.,]\d+)\s+-->\s+((?:\d+:)?\d+:\d+[.,]\d+)`)
+	markup    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// parseSubtitles reads SRT and WebVTT, which only really differ in their
+// headers and the separator used for milliseconds
+func parseSubtitles(s string) Cues {
+	out := Cues{}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	for _, block := range strings.Split(s, "\n\n") {
+		var (
+			cue   *Cue
+			lines []string
+		)
+		for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+			if cue != nil {
+				if line = strings.TrimSpace(html.UnescapeString(markup.ReplaceAllString(line, ""))); line != "" {
+					lines = append(lines, line)
+				}
+				continue
+			}
+
+			// Anything before the timing is a cue number or identifier
+			if m := cueTiming.FindStringSubmatch(line); m != nil {
+				cue = &Cue{Start: cueTime(m[1]), End: cueTime(m[2])}
+			}
+		}
+
+		if cue != nil && len(lines) > 0 {
+			cue.Text = strings.Join(lines, " ")
+			out = append(out, *cue)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
+
+// cueTime reads a subtitle timestamp, [HH:]MM:SS.mmm or [HH:]MM:SS,mmm
+func cueTime(s string) float64 {
+	total := 0.0
+	for _, part := range strings.Split(strings.Replace(s, ",", ".", 1), ":") {
+		n, _ := strconv.ParseFloat(part, 64)
+		total = total*60 + n
+	}
+
+	return total
+}
+
+var (
+	paragraph = regexp.MustCompile(`(?is)<(?:p|br|div|li|h\d)[^>]*>`)
+	hidden    = regexp.MustCompile(`(?is)<head.*?</head>|<script.*?</script>|<style.*?</style>`)
+)
+
+// parseHTMLTranscript splits an HTML transcript into untimed cues, one per
+// paragraph
+func parseHTMLTranscript(s string) Cues {
+	out := Cues{}
+	for _, p := range paragraph.Split(hidden.ReplaceAllString(s, ""), -1) {
+		text := strings.Join(strings.Fields(html.UnescapeString(markup.ReplaceAllString(p, " "))), " ")
+		if text != "" {
+			out = append(out, Cue{Text: text})
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,156 @@
+package pod
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Defaults used when UpdateOptions are left unset
+const (
+	DefaultWorkers = 8
+	DefaultPerHost = 2
+	DefaultTimeout = 30 * time.Second
+)
+
+// UpdateOptions control how feeds are refreshed
+type UpdateOptions struct {
+	Workers int           // Number of feeds refreshed at once
+	PerHost int           // Number of concurrent requests allowed to a single host
+	Timeout time.Duration // Time allowed to fetch and parse each feed
+	Force   bool          // Ignore HTTP caching and fetch every feed in full
+}
+
+// UpdateResult is the outcome of refreshing a single feed. Err is ErrNotModified
+// or ErrCached if the feed was skipped because nothing had changed.
+type UpdateResult struct {
+	Feed        *Feed
+	NewEpisodes int
+	Duration    time.Duration
+	Err         error
+}
+
+// Update the store, refreshing feeds concurrently. Results are returned in the
+// same order as the store's feeds.
+func (store *Store) Update(opts UpdateOptions) []UpdateResult {
+	return updateFeeds(store.Feeds, opts)
+}
+
+// Snapshot is a copy of the store's feeds that can be updated while the store
+// itself is in use
+type Snapshot struct {
+	Feeds Feeds
+	base  Feeds // The feeds as they were copied
+}
+
+// Snapshot copies the store's feeds so they can be refreshed without holding
+// up anything else using the store. The refreshed copies are merged back in
+// with Merge.
+func (store *Store) Snapshot() *Snapshot {
+	s := &Snapshot{}
+	for _, f := range store.Feeds {
+		s.Feeds = append(s.Feeds, f.clone())
+		s.base = append(s.base, f.clone())
+	}
+
+	return s
+}
+
+// Update the copied feeds, as Store.Update does
+func (s *Snapshot) Update(opts UpdateOptions) []UpdateResult {
+	return updateFeeds(s.Feeds, opts)
+}
+
+// Merge feeds refreshed in s back into the store and save them. Changes made
+// to the store's feeds since the snapshot was taken, like episodes being
+// played, are kept and feeds deleted meanwhile stay deleted.
+func (store *Store) Merge(s *Snapshot) error {
+	var (
+		live    = store.Feeds.byRSS()
+		changed = Feeds{}
+	)
+	for i, f := range s.Feeds {
+		l := live[f.RSS]
+		if l == nil {
+			continue
+		}
+
+		if err := mergeFeed(l, s.base[i], f); err != nil {
+			return err
+		}
+		changed = append(changed, l)
+	}
+
+	return store.SaveFeed(changed...)
+}
+
+// updateFeeds refreshes feeds concurrently
+func updateFeeds(feeds Feeds, opts UpdateOptions) []UpdateResult {
+	if opts.Workers < 1 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.PerHost < 1 {
+		opts.PerHost = DefaultPerHost
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	var (
+		results = make([]UpdateResult, len(feeds))
+		hosts   = make(map[string]chan struct{})
+		jobs    = make(chan int)
+		wg      sync.WaitGroup
+	)
+
+	// One semaphore per host, created up front so workers only ever read the map
+	for _, f := range feeds {
+		h := host(f.RSS)
+		if _, ok := hosts[h]; !ok {
+			hosts[h] = make(chan struct{}, opts.PerHost)
+		}
+	}
+
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				var (
+					f   = feeds[i]
+					sem = hosts[host(f.RSS)]
+				)
+
+				// Only time the fetch, not the wait for a slot
+				sem <- struct{}{}
+				start := time.Now()
+				ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+				n, err := f.Update(ctx, opts.Force)
+				cancel()
+				<-sem
+
+				results[i] = UpdateResult{Feed: f, NewEpisodes: n, Duration: time.Since(start), Err: err}
+			}
+		}()
+	}
+
+	for i := range feeds {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// host returns the host portion of a feed url for rate limiting
+func host(rss string) string {
+	u, err := url.Parse(rss)
+	if err != nil {
+		return rss
+	}
+
+	return u.Host
+}